@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go-rest/config"
+	"go-rest/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+const usage = `Usage:
+  go-rest [flags]                  jalankan server
+  go-rest [flags] config print     tampilkan konfigurasi efektif (secret disamarkan)
+  go-rest migrate up               terapkan semua migration yang belum jalan
+  go-rest migrate down [n]         revert n migration terakhir (default 1)
+  go-rest migrate to <version>     migrate naik/turun sampai versi tertentu (0 = kosong)
+  go-rest migrate status           tampilkan status setiap migration
+  go-rest hash-password [--bcrypt] buat hash argon2id (atau bcrypt) untuk config.yaml;
+                                   password diminta tanpa echo atau dibaca dari stdin
+`
+
+// printUsage prints the commands and the flags of fs
+func printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	fmt.Fprint(out, usage)
+	fmt.Fprintln(out, "\nFlags (urutan prioritas: flag > env > file YAML > default):")
+	fs.PrintDefaults()
+}
+
+// runCommand executes a CLI subcommand and returns the process exit code
+func runCommand(cfg config.Config, args []string) int {
+	switch args[0] {
+	case "migrate":
+		return migrateCommand(cfg, args[1:])
+	case "config":
+		return configCommand(cfg, args[1:])
+	case "hash-password":
+		return hashPasswordCommand(args[1:])
+	case "help":
+		printUsage(config.NewFlagSet(os.Stdout))
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "❌ Perintah tidak dikenal: %s\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func configCommand(cfg config.Config, args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	if cfg.File != "" {
+		fmt.Printf("# file: %s\n", cfg.File)
+	}
+	os.Stdout.Write(out)
+	return 0
+}
+
+func migrateCommand(cfg config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	var run func(ctx context.Context, pool *pgxpool.Pool) error
+	switch args[0] {
+	case "up":
+		run = config.MigrateUp
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "❌ Jumlah step tidak valid:", args[1])
+				return 2
+			}
+			steps = n
+		}
+		run = func(ctx context.Context, pool *pgxpool.Pool) error {
+			return config.MigrateDown(ctx, pool, steps)
+		}
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		target, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || target < 0 {
+			fmt.Fprintln(os.Stderr, "❌ Versi tidak valid:", args[1])
+			return 2
+		}
+		run = func(ctx context.Context, pool *pgxpool.Pool) error {
+			return config.MigrateTo(ctx, pool, target)
+		}
+	case "status":
+		run = func(ctx context.Context, pool *pgxpool.Pool) error {
+			states, err := config.MigrationStatus(ctx, pool)
+			if err == nil {
+				printMigrationStatus(states)
+			}
+			return err
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "❌ Sub-perintah migrate tidak dikenal: %s\n\n%s", args[0], usage)
+		return 2
+	}
+
+	pool, err := config.InitDB(cfg.Database)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Gagal konek ke database:", err)
+		return 1
+	}
+	defer pool.Close()
+
+	if err := run(context.Background(), pool); err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	return 0
+}
+
+func printMigrationStatus(states []config.MigrationState) {
+	fmt.Printf("%-8s %-32s %s\n", "VERSION", "NAME", "APPLIED AT")
+	for _, s := range states {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-8d %-32s %s\n", s.Version, s.Name, applied)
+	}
+}
+
+func hashPasswordCommand(args []string) int {
+	algorithm := utils.HashArgon2id
+	if len(args) > 0 && args[0] == "--bcrypt" {
+		algorithm = utils.HashBcrypt
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		// arguments are visible in ps output and shell history
+		fmt.Fprintln(os.Stderr, "❌ Password tidak diterima sebagai argumen; ketik di prompt atau kirim lewat stdin")
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Gagal membaca password:", err)
+		return 1
+	}
+	if password == "" {
+		fmt.Fprintln(os.Stderr, "❌ Password tidak boleh kosong")
+		return 2
+	}
+
+	hash, err := utils.HashPassword(password, algorithm)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "❌", err)
+		return 1
+	}
+	fmt.Println(hash)
+	return 0
+}
+
+// readPassword prompts without echo on a terminal, otherwise reads one line from stdin
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
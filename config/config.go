@@ -0,0 +1,384 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-rest/utils"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is read when neither -config nor CONFIG_FILE names a file
+const DefaultFile = "config.yaml"
+
+// Config is the complete configuration of the server. Values are taken from,
+// in increasing order of precedence: defaults, the YAML file, environment
+// variables (also from .env) and command-line flags.
+type Config struct {
+	Server   ServerConfig        `yaml:"server"`
+	Database DatabaseConfig      `yaml:"database"`
+	Auth     AuthConfig          `yaml:"auth"`
+	Log      utils.LogConfig     `yaml:"log"`
+	Tracing  utils.TracingConfig `yaml:"tracing"`
+	// users, roles, login and rate_limits stay at the top level of the file
+	utils.AppConfig `yaml:",inline"`
+
+	// File is the YAML file the config was read from, "" if none
+	File string `yaml:"-"`
+}
+
+// ServerConfig holds the listen address and http.Server limits; zero timeouts disable a limit
+type ServerConfig struct {
+	Addr              string        `yaml:"addr"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes"`
+	// ShutdownTimeout is how long in-flight requests may run after SIGINT/SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+}
+
+// DatabaseConfig selects the storage backend and how to reach PostgreSQL.
+// URL wins over the separate connection fields.
+type DatabaseConfig struct {
+	// Store is "postgres" or "memory"
+	Store    string `yaml:"store"`
+	URL      string `yaml:"url"`
+	Host     string `yaml:"host"`
+	Port     string `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Name     string `yaml:"name"`
+}
+
+// AuthConfig holds token lifetimes and signing keys
+type AuthConfig struct {
+	AccessTokenTTL     time.Duration `yaml:"access_token_ttl"`
+	RefreshTokenTTL    time.Duration `yaml:"refresh_token_ttl"`
+	utils.JWTKeyConfig `yaml:",inline"`
+}
+
+// Default returns the configuration used for everything not set elsewhere
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			MaxHeaderBytes:    64 << 10,
+			ShutdownTimeout:   30 * time.Second,
+		},
+		Database: DatabaseConfig{Store: "postgres", Host: "localhost", Port: "5432"},
+		Auth: AuthConfig{
+			AccessTokenTTL:  utils.DefaultAccessTokenTTL,
+			RefreshTokenTTL: utils.DefaultRefreshTokenTTL,
+		},
+	}
+}
+
+// ConnString returns the PostgreSQL connection URL
+func (d DatabaseConfig) ConnString() string {
+	if d.URL != "" {
+		return d.URL
+	}
+	u := url.URL{Scheme: "postgres", Host: net.JoinHostPort(d.Host, d.Port), Path: "/" + d.Name}
+	if d.User != "" {
+		u.User = url.UserPassword(d.User, d.Password)
+	}
+	return u.String()
+}
+
+// setting is one value that can come from an environment variable and a flag
+type setting struct {
+	// key is the dotted YAML path, also used as flag name
+	key string
+	env string
+	// secret settings are not offered as flags, which other users can see in ps
+	secret bool
+	set    func(c *Config, v string) error
+}
+
+func stringSetting(f func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		*f(c) = v
+		return nil
+	}
+}
+
+func durationSetting(f func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*f(c) = d
+		return nil
+	}
+}
+
+func intSetting(f func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*f(c) = n
+		return nil
+	}
+}
+
+func boolSetting(f func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*f(c) = b
+		return nil
+	}
+}
+
+// listSetting splits a comma separated value
+func listSetting(f func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		var list []string
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*f(c) = list
+		return nil
+	}
+}
+
+var settings = []setting{
+	{key: "server.addr", env: "HTTP_ADDR", set: stringSetting(func(c *Config) *string { return &c.Server.Addr })},
+	{key: "server.read_header_timeout", env: "HTTP_READ_HEADER_TIMEOUT", set: durationSetting(func(c *Config) *time.Duration { return &c.Server.ReadHeaderTimeout })},
+	{key: "server.read_timeout", env: "HTTP_READ_TIMEOUT", set: durationSetting(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{key: "server.write_timeout", env: "HTTP_WRITE_TIMEOUT", set: durationSetting(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{key: "server.idle_timeout", env: "HTTP_IDLE_TIMEOUT", set: durationSetting(func(c *Config) *time.Duration { return &c.Server.IdleTimeout })},
+	{key: "server.max_header_bytes", env: "HTTP_MAX_HEADER_BYTES", set: intSetting(func(c *Config) *int { return &c.Server.MaxHeaderBytes })},
+	{key: "server.shutdown_timeout", env: "SHUTDOWN_TIMEOUT", set: durationSetting(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+
+	{key: "database.store", env: "CHARACTER_STORE", set: stringSetting(func(c *Config) *string { return &c.Database.Store })},
+	{key: "database.url", env: "DATABASE_URL", secret: true, set: stringSetting(func(c *Config) *string { return &c.Database.URL })},
+	{key: "database.host", env: "DB_HOST", set: stringSetting(func(c *Config) *string { return &c.Database.Host })},
+	{key: "database.port", env: "DB_PORT", set: stringSetting(func(c *Config) *string { return &c.Database.Port })},
+	{key: "database.user", env: "DB_USER", set: stringSetting(func(c *Config) *string { return &c.Database.User })},
+	{key: "database.password", env: "DB_PASSWORD", secret: true, set: stringSetting(func(c *Config) *string { return &c.Database.Password })},
+	{key: "database.name", env: "DB_NAME", set: stringSetting(func(c *Config) *string { return &c.Database.Name })},
+
+	{key: "auth.access_token_ttl", env: "ACCESS_TOKEN_TTL", set: durationSetting(func(c *Config) *time.Duration { return &c.Auth.AccessTokenTTL })},
+	{key: "auth.refresh_token_ttl", env: "REFRESH_TOKEN_TTL", set: durationSetting(func(c *Config) *time.Duration { return &c.Auth.RefreshTokenTTL })},
+	{key: "auth.jwt_secret", env: "JWT_SECRET", secret: true, set: stringSetting(func(c *Config) *string { return &c.Auth.Secret })},
+	{key: "auth.signing_key", env: "JWT_SIGNING_KEY", set: stringSetting(func(c *Config) *string { return &c.Auth.SigningKey })},
+	{key: "auth.signing_kid", env: "JWT_SIGNING_KID", set: stringSetting(func(c *Config) *string { return &c.Auth.SigningKID })},
+	{key: "auth.verify_keys", env: "JWT_VERIFY_KEYS", set: listSetting(func(c *Config) *[]string { return &c.Auth.VerifyKeys })},
+
+	{key: "log.format", env: "LOG_FORMAT", set: stringSetting(func(c *Config) *string { return &c.Log.Format })},
+	{key: "log.level", env: "LOG_LEVEL", set: stringSetting(func(c *Config) *string { return &c.Log.Level })},
+
+	{key: "tracing.exporter", env: "OTEL_TRACES_EXPORTER", set: stringSetting(func(c *Config) *string { return &c.Tracing.Exporter })},
+	{key: "tracing.file", env: "TRACE_FILE", set: stringSetting(func(c *Config) *string { return &c.Tracing.File })},
+	{key: "tracing.endpoint", env: "OTEL_EXPORTER_OTLP_ENDPOINT", set: stringSetting(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{key: "tracing.insecure", env: "OTEL_EXPORTER_OTLP_INSECURE", set: boolSetting(func(c *Config) *bool { return &c.Tracing.Insecure })},
+}
+
+// NewFlagSet declares -config and one flag per non-secret setting, named by
+// its YAML path (e.g. -server.addr). Flags stop at the first command argument.
+func NewFlagSet(output io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet("go-rest", flag.ContinueOnError)
+	fs.SetOutput(output)
+	fs.String("config", "", "file YAML konfigurasi (env CONFIG_FILE, default "+DefaultFile+")")
+	for _, s := range settings {
+		if !s.secret {
+			fs.String(s.key, "", "env "+s.env)
+		}
+	}
+	return fs
+}
+
+// Load parses args with fs, reads .env, the YAML file and the environment, and
+// returns the validated config plus the arguments left after the flags
+func Load(fs *flag.FlagSet, args []string) (Config, []string, error) {
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) { flags[f.Name] = f.Value.String() })
+
+	// .env only fills variables that are not already set
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, nil, fmt.Errorf(".env: %w", err)
+	}
+
+	path, explicit := flags["config"], true
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path == "" {
+		path, explicit = DefaultFile, false
+	}
+	cfg, err := ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		cfg, err = Default(), nil
+	}
+	if err != nil {
+		return Config{}, nil, err
+	}
+
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			if err := s.set(&cfg, v); err != nil {
+				return Config{}, nil, fmt.Errorf("%s: %w", s.env, err)
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.key]; ok {
+			if err := s.set(&cfg, v); err != nil {
+				return Config{}, nil, fmt.Errorf("-%s: %w", s.key, err)
+			}
+		}
+	}
+
+	cfg.fillDefaults()
+	if err := cfg.Validate(); err != nil {
+		return Config{}, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// ReadFile reads a YAML config over the defaults; unknown keys are rejected
+// so typos do not silently fall back to a default
+func ReadFile(path string) (Config, error) {
+	cfg := Default()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.File = path
+	return cfg, nil
+}
+
+// fillDefaults makes implicit defaults explicit, so `config print` shows what is used
+func (c *Config) fillDefaults() {
+	c.Login = c.Login.WithDefaults()
+	if c.RateLimits == nil {
+		limits := utils.DefaultRateLimitConfig
+		c.RateLimits = &limits
+	}
+}
+
+// Validate checks every section of the config
+func (c Config) Validate() error {
+	s := c.Server
+	if s.Addr == "" {
+		return errors.New("server.addr is required")
+	}
+	for name, d := range map[string]time.Duration{
+		"read_header_timeout": s.ReadHeaderTimeout,
+		"read_timeout":        s.ReadTimeout,
+		"write_timeout":       s.WriteTimeout,
+		"idle_timeout":        s.IdleTimeout,
+		"shutdown_timeout":    s.ShutdownTimeout,
+	} {
+		if d < 0 {
+			return fmt.Errorf("server.%s must not be negative", name)
+		}
+	}
+	if s.MaxHeaderBytes <= 0 {
+		return errors.New("server.max_header_bytes must be positive")
+	}
+
+	switch c.Database.Store {
+	case "postgres":
+		if c.Database.URL != "" {
+			// accepts URLs and key=value DSNs, exactly like the connection later on
+			if _, err := pgconn.ParseConfig(c.Database.URL); err != nil {
+				return fmt.Errorf("database.url: %w", err)
+			}
+		}
+	case "memory":
+	default:
+		return fmt.Errorf("database.store %q: must be postgres or memory", c.Database.Store)
+	}
+
+	if c.Auth.AccessTokenTTL <= 0 || c.Auth.RefreshTokenTTL <= 0 {
+		return errors.New("auth.access_token_ttl and auth.refresh_token_ttl must be positive")
+	}
+	if c.Auth.AccessTokenTTL > c.Auth.RefreshTokenTTL {
+		return errors.New("auth.access_token_ttl must not be longer than auth.refresh_token_ttl")
+	}
+
+	if err := c.Log.Validate(); err != nil {
+		return err
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		return err
+	}
+	return utils.ValidateAppConfig(c.AppConfig)
+}
+
+// redacted replaces secret values
+const redacted = "REDACTED"
+
+// Redacted returns a copy that is safe to print: passwords, secrets and the
+// password in the database URL are replaced
+func (c Config) Redacted() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = redacted
+	}
+	if c.Database.URL != "" {
+		c.Database.URL = redactConnString(c.Database.URL)
+	}
+	if c.Auth.Secret != "" {
+		c.Auth.Secret = redacted
+	}
+	users := make([]utils.User, len(c.Users))
+	for i, u := range c.Users {
+		u.Password = redacted
+		users[i] = u
+	}
+	c.Users = users
+	return c
+}
+
+// redactConnString hides the password of a postgres:// URL, in the userinfo and
+// in the password query parameter. Anything else, such as a key=value DSN, is
+// replaced as a whole since its password cannot be located reliably.
+func redactConnString(conn string) string {
+	u, err := url.Parse(conn)
+	if err != nil || (u.Scheme != "postgres" && u.Scheme != "postgresql") {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	if q := u.Query(); q.Has("password") {
+		q.Set("password", redacted)
+		u.RawQuery = q.Encode()
+	}
+	return u.String()
+}
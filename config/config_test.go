@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactedHidesDatabasePasswords(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"postgres://u:s3cret@db/x", "postgres://u:REDACTED@db/x"},
+		{"postgres://u@db/x?password=s3cret&sslmode=disable", "postgres://u@db/x?password=REDACTED&sslmode=disable"},
+		{"postgresql://u:s3cret@db/x?password=s3cret", "postgresql://u:REDACTED@db/x?password=REDACTED"},
+		{"postgres://u@db/x", "postgres://u@db/x"},
+		{"host=db user=u password=s3cret dbname=x", "REDACTED"},
+		{"mysql://u:s3cret@db/x", "REDACTED"},
+	}
+	for _, tt := range tests {
+		c := Default()
+		c.Database.URL = tt.url
+		got := c.Redacted().Database.URL
+		if got != tt.want {
+			t.Errorf("Redacted(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+		if strings.Contains(got, "s3cret") {
+			t.Errorf("Redacted(%q) leaks the password: %q", tt.url, got)
+		}
+	}
+}
+
+func TestValidateDatabaseURL(t *testing.T) {
+	for url, ok := range map[string]bool{
+		"postgres://u:p@db:5432/x":        true,
+		"host=db user=u dbname=x":         true,
+		"postgres://u:p@db:notaport/x":    false,
+		"host=db user=u dbname=x port=ab": false,
+	} {
+		c := Default()
+		c.Database.URL = url
+		if err := c.Validate(); (err == nil) != ok {
+			t.Errorf("Validate(%q) = %v, want ok=%v", url, err, ok)
+		}
+	}
+}
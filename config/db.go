@@ -3,47 +3,38 @@ package config
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 )
 
-var DB *pgxpool.Pool
-
-func InitDB() (*pgxpool.Pool, error) {
-	// Load .env
-	if err := godotenv.Load(); err != nil {
-		log.Println("⚠️ Warning: .env file not loaded")
-	}
-
-	// Buat connection string dari .env
-	dbURL := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-	)
+// InitDB connects to PostgreSQL and checks the connection
+func InitDB(cfg DatabaseConfig) (*pgxpool.Pool, error) {
+	dbURL := cfg.ConnString()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	pool, err := pgxpool.New(ctx, dbURL)
+	poolCfg, err := pgxpool.ParseConfig(dbURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+	// every query gets a tracing span
+	poolCfg.ConnConfig.Tracer = newQueryTracer()
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
 	// Test koneksi
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("database ping failed: %w", err)
 	}
 
-	DB = pool
-	fmt.Println("✅ Connected to PostgreSQL")
+	slog.Info("connected to PostgreSQL")
 
 	return pool, nil
 }
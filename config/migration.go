@@ -2,30 +2,281 @@ package config
 
 import (
 	"context"
+	"embed"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func RunMigration(pool *pgxpool.Pool) error {
-	ctx := context.Background()
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
 
-	query := `
-	CREATE TABLE IF NOT EXISTS characters (
-		id SERIAL PRIMARY KEY,
+// migrationLockKey identifies the advisory lock held while migrating,
+// so several instances starting at once apply each migration only once
+const migrationLockKey int64 = 0x676f72657374 // "gorest"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is one numbered schema change with its up and down SQL
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationState reports whether a migration has been applied
+type MigrationState struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads the embedded migration files, ordered by version
+func LoadMigrations() ([]Migration, error) {
+	return loadMigrations(migrationFiles)
+}
+
+// loadMigrations reads and pairs the up and down files in the migrations directory of fsys
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, e := range entries {
+		m := migrationFileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", e.Name())
+		}
+		version, _ := strconv.ParseInt(m[1], 10, 64)
+		data, err := fs.ReadFile(fsys, "migrations/"+e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(data)
+		} else {
+			mig.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrateUp applies every pending migration
+func MigrateUp(ctx context.Context, pool *pgxpool.Pool) error {
+	return MigrateTo(ctx, pool, -1)
+}
+
+// MigrateDown reverts the last steps applied migrations
+func MigrateDown(ctx context.Context, pool *pgxpool.Pool, steps int) error {
+	return withMigrationLock(ctx, pool, func(conn *pgx.Conn, migrations []Migration, applied map[int64]time.Time) error {
+		for _, m := range downPlan(migrations, applied, steps) {
+			if err := revertMigration(ctx, conn, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// downPlan returns the last steps applied migrations, newest first
+func downPlan(migrations []Migration, applied map[int64]time.Time, steps int) []Migration {
+	var revert []Migration
+	for i := len(migrations) - 1; i >= 0 && len(revert) < steps; i-- {
+		if _, ok := applied[migrations[i].Version]; ok {
+			revert = append(revert, migrations[i])
+		}
+	}
+	return revert
+}
+
+// MigrateTo migrates up or down until exactly the migrations up to target are applied.
+// A negative target means the latest version, 0 reverts everything.
+func MigrateTo(ctx context.Context, pool *pgxpool.Pool, target int64) error {
+	return withMigrationLock(ctx, pool, func(conn *pgx.Conn, migrations []Migration, applied map[int64]time.Time) error {
+		revert, apply, err := migrationPlan(migrations, applied, target)
+		if err != nil {
+			return err
+		}
+		for _, m := range revert {
+			if err := revertMigration(ctx, conn, m); err != nil {
+				return err
+			}
+		}
+		for _, m := range apply {
+			if err := applyMigration(ctx, conn, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// migrationPlan returns the migrations MigrateTo reverts, newest first, and then applies, oldest first
+func migrationPlan(migrations []Migration, applied map[int64]time.Time, target int64) (revert, apply []Migration, err error) {
+	if target > 0 && !hasVersion(migrations, target) {
+		return nil, nil, fmt.Errorf("unknown migration version %d", target)
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; ok && target >= 0 && m.Version > target {
+			revert = append(revert, m)
+		}
+	}
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok && (target < 0 || m.Version <= target) {
+			apply = append(apply, m)
+		}
+	}
+	return revert, apply, nil
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func MigrationStatus(ctx context.Context, pool *pgxpool.Pool) ([]MigrationState, error) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Release()
+
+	applied, err := appliedMigrations(ctx, conn.Conn())
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, len(migrations))
+	for i, m := range migrations {
+		states[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			states[i].AppliedAt = &at
+		}
+	}
+	return states, nil
+}
+
+func hasVersion(migrations []Migration, version int64) bool {
+	for _, m := range migrations {
+		if m.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// withMigrationLock runs fn on a dedicated connection holding the migration advisory lock
+func withMigrationLock(ctx context.Context, pool *pgxpool.Pool, fn func(*pgx.Conn, []Migration, map[int64]time.Time) error) error {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		return err
+	}
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("gagal mengambil migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if _, err := conn.Exec(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
 		name TEXT NOT NULL,
-		role TEXT NOT NULL,
-		game TEXT NOT NULL,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW(),
-		deleted_at TIMESTAMPTZ NULL
-	);`
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`); err != nil {
+		return fmt.Errorf("gagal membuat schema_migrations: %w", err)
+	}
 
-	_, err := pool.Exec(ctx, query)
+	// read the applied set only after taking the lock, another instance may just have migrated
+	applied, err := appliedMigrations(ctx, conn.Conn())
 	if err != nil {
-		return fmt.Errorf("gagal menjalankan migration: %w", err)
+		return err
+	}
+	return fn(conn.Conn(), migrations, applied)
+}
+
+func appliedMigrations(ctx context.Context, conn *pgx.Conn) (map[int64]time.Time, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, err
+	}
+	applied := map[int64]time.Time{}
+	if !exists {
+		return applied, nil
 	}
 
-	fmt.Println("✅ Migration berhasil dijalankan")
+	rows, err := conn.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int64
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func applyMigration(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Up); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("gagal menjalankan migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	slog.Info("migration diterapkan", "version", m.Version, "name", m.Name)
+	return nil
+}
+
+func revertMigration(ctx context.Context, conn *pgx.Conn, m Migration) error {
+	err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, m.Down); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version=$1", m.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("gagal revert migration %d_%s: %w", m.Version, m.Name, err)
+	}
+	slog.Info("migration di-revert", "version", m.Version, "name", m.Name)
 	return nil
 }
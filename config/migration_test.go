@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestEmbeddedMigrationsPairUp(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range migrations {
+		// versions start at 1 and leave no gaps, so MigrateTo can target any of them
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s at position %d, want version %d", m.Version, m.Name, i, i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d_%s has an empty up or down file", m.Version, m.Name)
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	sql := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := []struct {
+		name    string
+		files   []string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "ordered by version, not by name",
+			files: []string{"10_ten.up.sql", "10_ten.down.sql", "2_two.up.sql", "2_two.down.sql", "1_one.up.sql", "1_one.down.sql"},
+			want:  "[1 2 10]",
+		},
+		{name: "missing down", files: []string{"1_one.up.sql"}, wantErr: "needs both up and down"},
+		{name: "missing up", files: []string{"1_one.down.sql"}, wantErr: "needs both up and down"},
+		{name: "two names", files: []string{"1_one.up.sql", "1_uno.down.sql"}, wantErr: "two names"},
+		{name: "bad file name", files: []string{"one.up.sql"}, wantErr: "invalid migration file name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, f := range tt.files {
+				fsys["migrations/"+f] = sql
+			}
+			migrations, err := loadMigrations(fsys)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(migrations); got != tt.want {
+				t.Errorf("versions %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMigrationPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+	applied := func(vs ...int64) map[int64]time.Time {
+		m := map[int64]time.Time{}
+		for _, v := range vs {
+			m[v] = time.Now()
+		}
+		return m
+	}
+	tests := []struct {
+		name          string
+		applied       map[int64]time.Time
+		target        int64
+		revert, apply string
+	}{
+		{"up from empty", applied(), -1, "[]", "[1 2 3 4]"},
+		{"up fills gaps", applied(1, 3), -1, "[]", "[2 4]"},
+		{"up to target", applied(1), 3, "[]", "[2 3]"},
+		{"down to target newest first", applied(1, 2, 3, 4), 2, "[4 3]", "[]"},
+		{"down to zero", applied(1, 2, 3), 0, "[3 2 1]", "[]"},
+		{"already there", applied(1, 2), 2, "[]", "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			revert, apply, err := migrationPlan(migrations, tt.applied, tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := versions(revert); got != tt.revert {
+				t.Errorf("revert %s, want %s", got, tt.revert)
+			}
+			if got := versions(apply); got != tt.apply {
+				t.Errorf("apply %s, want %s", got, tt.apply)
+			}
+		})
+	}
+
+	if _, _, err := migrationPlan(migrations, applied(), 9); err == nil {
+		t.Error("unknown target version accepted")
+	}
+}
+
+func TestDownPlan(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}}
+	applied := map[int64]time.Time{1: time.Now(), 2: time.Now()}
+	for steps, want := range map[int]string{0: "[]", 1: "[2]", 2: "[2 1]", 5: "[2 1]"} {
+		if got := versions(downPlan(migrations, applied, steps)); got != want {
+			t.Errorf("down %d: %s, want %s", steps, got, want)
+		}
+	}
+}
+
+// versions lists the versions of migrations in order
+func versions(migrations []Migration) string {
+	vs := make([]int64, len(migrations))
+	for i, m := range migrations {
+		vs[i] = m.Version
+	}
+	return fmt.Sprint(vs)
+}
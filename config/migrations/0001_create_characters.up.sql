@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS characters (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	role TEXT NOT NULL,
+	game TEXT NOT NULL,
+	created_at TIMESTAMPTZ DEFAULT NOW(),
+	updated_at TIMESTAMPTZ DEFAULT NOW(),
+	deleted_at TIMESTAMPTZ NULL
+);
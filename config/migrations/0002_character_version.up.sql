@@ -0,0 +1,2 @@
+-- optimistic concurrency (ETag / If-Match)
+ALTER TABLE characters ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_characters_game;
+DROP INDEX IF EXISTS idx_characters_role;
+DROP INDEX IF EXISTS idx_characters_created_at;
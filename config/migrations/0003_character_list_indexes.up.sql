@@ -0,0 +1,4 @@
+-- filters and sorting of GET /api/characters
+CREATE INDEX IF NOT EXISTS idx_characters_created_at ON characters (created_at, id) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_characters_role ON characters (lower(role)) WHERE deleted_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_characters_game ON characters (lower(game)) WHERE deleted_at IS NULL;
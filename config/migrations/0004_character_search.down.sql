@@ -0,0 +1,6 @@
+-- the pg_trgm extension is left installed, other schemas may use it
+DROP INDEX IF EXISTS idx_characters_game_trgm;
+DROP INDEX IF EXISTS idx_characters_role_trgm;
+DROP INDEX IF EXISTS idx_characters_name_trgm;
+DROP INDEX IF EXISTS idx_characters_search;
+ALTER TABLE characters DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,11 @@
+-- full-text & fuzzy search
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+ALTER TABLE characters ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('simple', name), 'A') ||
+	setweight(to_tsvector('simple', role), 'B') ||
+	setweight(to_tsvector('simple', game), 'C')
+) STORED;
+CREATE INDEX IF NOT EXISTS idx_characters_search ON characters USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_characters_name_trgm ON characters USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_characters_role_trgm ON characters USING GIN (role gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_characters_game_trgm ON characters USING GIN (game gin_trgm_ops);
@@ -0,0 +1,5 @@
+-- refresh tokens issued before this migration were derived from the issue time
+-- and can be guessed, so they are dropped and their owners have to log in again
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS family_id TEXT NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
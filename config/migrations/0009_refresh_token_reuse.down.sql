@@ -0,0 +1,7 @@
+-- without rotated_at a kept rotated token would be accepted again, so drop them first
+DELETE FROM refresh_tokens WHERE rotated_at IS NOT NULL OR revoked_at IS NOT NULL;
+ALTER TABLE refresh_tokens
+	DROP COLUMN IF EXISTS revoked_at,
+	DROP COLUMN IF EXISTS rotated_at,
+	DROP COLUMN IF EXISTS access_expires_at,
+	DROP COLUMN IF EXISTS access_jti;
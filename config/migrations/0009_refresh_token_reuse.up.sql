@@ -0,0 +1,5 @@
+ALTER TABLE refresh_tokens
+	ADD COLUMN IF NOT EXISTS access_jti TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS access_expires_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMPTZ,
+	ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ;
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestQuerySpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := queryTracer{tracer: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).Tracer("test")}
+
+	tests := []struct {
+		sql, name string
+		err       error
+		want      codes.Code
+	}{
+		{"  select * FROM characters WHERE id=$1", "pgx SELECT", nil, codes.Unset},
+		{"UPDATE characters SET name=$1", "pgx UPDATE", pgx.ErrNoRows, codes.Unset},
+		{"INSERT INTO characters VALUES ($1)", "pgx INSERT", errors.New("duplicate key"), codes.Error},
+		{"", "pgx QUERY", nil, codes.Unset},
+	}
+	for _, tt := range tests {
+		recorder.Reset()
+		ctx := tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: tt.sql})
+		tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: tt.err})
+
+		spans := recorder.Ended()
+		if len(spans) != 1 {
+			t.Fatalf("%q: %d spans, want 1", tt.sql, len(spans))
+		}
+		s := spans[0]
+		if s.Name() != tt.name || s.SpanKind() != trace.SpanKindClient {
+			t.Errorf("%q: span %s of kind %v, want client span %s", tt.sql, s.Name(), s.SpanKind(), tt.name)
+		}
+		if s.Status().Code != tt.want {
+			t.Errorf("%q: status %v, want %v", tt.sql, s.Status().Code, tt.want)
+		}
+		hasQuery := false
+		for _, a := range s.Attributes() {
+			hasQuery = hasQuery || a == semconv.DBQueryText(tt.sql)
+		}
+		if !hasQuery {
+			t.Errorf("%q: attributes %v lack the query text", tt.sql, s.Attributes())
+		}
+	}
+}
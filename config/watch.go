@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go-rest/utils"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce lets an editor finish writing before the file is read
+const watchDebounce = 250 * time.Millisecond
+
+// ReadAppConfig reads the reloadable part of a config file: users, roles, login
+// policy and rate limits. Environment variables and flags do not apply to these.
+func ReadAppConfig(path string) (utils.AppConfig, error) {
+	cfg, err := ReadFile(path)
+	if err != nil {
+		return utils.AppConfig{}, err
+	}
+	cfg.fillDefaults()
+	return cfg.AppConfig, nil
+}
+
+// Watch calls reload on every SIGHUP and when the content of the config file at
+// path changes, until ctx is done. The directory is watched rather than the file,
+// so editors that replace the file and Kubernetes ConfigMap symlink swaps are seen.
+// SIGHUP is handled even without a file or when the watcher cannot start, so it
+// never falls back to its default action of killing the server.
+func Watch(ctx context.Context, path string, reload func(context.Context)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	// nil channels block forever, leaving only SIGHUP when there is no watcher
+	var events chan fsnotify.Event
+	var errs chan error
+	if path != "" {
+		watcher, err := watchDir(filepath.Dir(path))
+		if err != nil {
+			slog.Warn("config watcher nonaktif, reload hanya lewat SIGHUP", "file", path, "error", err)
+		} else {
+			defer watcher.Close()
+			events, errs = watcher.Events, watcher.Errors
+		}
+	}
+
+	last := fileHash(path)
+	debounce := time.NewTimer(0)
+	<-debounce.C
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if path == "" {
+				slog.Warn("SIGHUP diabaikan, server berjalan tanpa file konfigurasi")
+				continue
+			}
+			last = fileHash(path)
+			reload(ctx)
+		case <-events:
+			debounce.Reset(watchDebounce)
+		case <-debounce.C:
+			// several events per save, and events for other files in the
+			// directory, are folded into one check of the content
+			if h := fileHash(path); h != nil && !bytes.Equal(h, last) {
+				last = h
+				reload(ctx)
+			}
+		case err := <-errs:
+			// keep running: SIGHUP still works and a dropped event is caught by the next one
+			slog.Warn("config watcher error", "file", path, "error", err)
+		}
+	}
+}
+
+// watchDir starts an fsnotify watcher on dir
+func watchDir(dir string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watch %s: %w", dir, err)
+	}
+	return watcher, nil
+}
+
+// fileHash returns the SHA-256 of the file at path, or nil if it cannot be read
+func fileHash(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
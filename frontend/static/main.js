@@ -1,4 +1,5 @@
  let editId = null;
+    let editVersion = null;
     let token = localStorage.getItem('authToken') || '';
     let refreshToken = localStorage.getItem('refreshToken') || '';
 
@@ -47,6 +48,7 @@
       localStorage.removeItem('refreshToken');
       refreshAuthUI();
       document.getElementById('characterCards').innerHTML = '';
+      document.getElementById('loadMore').style.display = 'none';
       showToast('Berhasil logout');
     }
 
@@ -93,18 +95,38 @@
       refreshAuthUI();
     }
 
+    // cursor halaman berikutnya dari header X-Next-Cursor, kosong jika sudah halaman terakhir
+    let nextCursor = '';
+
     async function loadCharacters() {
       if (!token) { alert('Silakan login dulu'); return; }
+      document.getElementById("characterCards").innerHTML = "";
+      nextCursor = '';
+      await fetchCharacterPage("/api/characters");
+      document.getElementById('emptyState').style.display =
+        document.getElementById("characterCards").children.length === 0 ? 'block' : 'none';
+    }
+
+    async function loadMoreCharacters() {
+      if (!nextCursor) return;
+      await fetchCharacterPage("/api/characters?cursor=" + encodeURIComponent(nextCursor));
+    }
+
+    // fetchCharacterPage menambahkan satu halaman karakter ke daftar dan menyimpan cursor berikutnya
+    async function fetchCharacterPage(url) {
       document.getElementById('loading').style.display = 'flex';
-      const res = await apiFetch("/api/characters");
-      const data = await res.json();
+      const res = await apiFetch(url);
       document.getElementById('loading').style.display = 'none';
+      if (!res.ok) {
+        showToast('Gagal memuat karakter', 'error');
+        return;
+      }
+      const data = await res.json();
+      nextCursor = res.headers.get('X-Next-Cursor') || '';
+      document.getElementById('loadMore').style.display = nextCursor ? 'inline-block' : 'none';
 
       const container = document.getElementById("characterCards");
-      container.innerHTML = "";
-      document.getElementById('emptyState').style.display = (!Array.isArray(data) || data.length === 0) ? 'block' : 'none';
-
-      data.forEach(c => {
+      (Array.isArray(data) ? data : []).forEach(c => {
         const card = document.createElement("div");
         card.className = "card";
 
@@ -113,16 +135,17 @@
           <p><strong>Role:</strong> ${c.role}</p>
           <p><strong>Game:</strong> ${c.game}</p>
           <div style="margin-top: 15px; text-align: center;">
-            <button class="btn-edit" onclick="editCharacter(${c.id}, '${c.name}', '${c.role}', '${c.game}')">Edit</button>
-            <button class="btn-delete" onclick="deleteCharacter(${c.id})">Hapus</button>
+            <button class="btn-edit" onclick="editCharacter(${c.id}, '${c.name}', '${c.role}', '${c.game}', ${c.version})">Edit</button>
+            <button class="btn-delete" onclick="deleteCharacter(${c.id}, ${c.version})">Hapus</button>
           </div>
         `;
         container.appendChild(card);
       });
     }
 
-    function editCharacter(id, name, role, game) {
+    function editCharacter(id, name, role, game, version) {
       editId = id;
+      editVersion = version;
       document.getElementById('modalTitle').textContent = 'Edit Karakter';
       document.getElementById("name").value = name;
       document.getElementById("role").value = role;
@@ -142,13 +165,18 @@
   };
 
   if (editId) {
-    await apiFetch(`/api/characters/${editId}`, {
+    // If-Match: tolak simpan jika karakter sudah diubah orang lain sejak dimuat
+    const res = await apiFetch(`/api/characters/${editId}`, {
       method: "PUT",
-      headers: { "Content-Type": "application/json" },
+      headers: { "Content-Type": "application/json", "If-Match": `"${editVersion}"` },
       body: JSON.stringify(character)
     });
     editId = null;
-    showToast('Perubahan tersimpan', 'success');
+    if (res.status === 412) {
+      showToast('Karakter sudah diubah orang lain, data dimuat ulang', 'error');
+    } else {
+      showToast('Perubahan tersimpan', 'success');
+    }
   } else {
     await apiFetch("/api/characters", {
       method: "POST",
@@ -164,12 +192,16 @@
 }
 
 
-    async function deleteCharacter(id) {
+    async function deleteCharacter(id, version) {
       if (confirm("Yakin mau hapus karakter ini?")) {
         if (!token) { alert('Silakan login dulu'); return; }
-        await apiFetch(`/api/characters/${id}`, { method: "DELETE" });
+        const res = await apiFetch(`/api/characters/${id}`, { method: "DELETE", headers: { "If-Match": `"${version}"` } });
         loadCharacters();
-        showToast('Karakter dihapus', 'success');
+        if (res.status === 412) {
+          showToast('Karakter sudah diubah orang lain, data dimuat ulang', 'error');
+        } else {
+          showToast('Karakter dihapus', 'success');
+        }
       }
     }
 
@@ -201,6 +233,7 @@
     function closeModal() {
       document.getElementById('modalBackdrop').style.display = 'none';
       editId = null;
+      editVersion = null;
     }
 
     // Close modal on backdrop click
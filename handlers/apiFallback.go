@@ -3,11 +3,15 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+
+	"go-rest/utils"
 )
 
 type errorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message"`
+	// RequestID correlates the error with the server logs
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // ApiNotFoundHandler returns JSON 404 for unknown /api/* routes
@@ -15,7 +19,8 @@ func ApiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusNotFound)
 	json.NewEncoder(w).Encode(errorResponse{
-		Error:   "not_found",
-		Message: "API route not found",
+		Error:     "not_found",
+		Message:   "API route not found",
+		RequestID: utils.RequestID(r),
 	})
 }
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-rest/models"
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+type createAPIKeyRequest struct {
+	Name      string     `json:"name" example:"nightly-import"`
+	Scopes    []string   `json:"scopes" example:"characters:read,characters:write"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type createAPIKeyResponse struct {
+	// Key is only returned once, store it somewhere safe
+	Key    string       `json:"key"`
+	APIKey utils.APIKey `json:"api_key"`
+}
+
+// ✅ GET API Keys
+// @Summary      Daftar API key (admin)
+// @Description  Semua API key service account, termasuk yang sudah dicabut atau kedaluwarsa. Key aslinya tidak pernah ditampilkan lagi.
+// @Tags         apikeys
+// @Produce      json
+// @Success      200  {array}   utils.APIKey
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /apikeys [get]
+// @Security     BearerAuth
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := utils.ListAPIKeys(r.Context())
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// ✅ POST API Key
+// @Summary      Buat API key (admin)
+// @Description  Membuat API key dengan scope (permission) dan masa berlaku opsional. Key hanya ditampilkan sekali di response ini.
+// @Tags         apikeys
+// @Accept       json
+// @Produce      json
+// @Param        apikey  body      createAPIKeyRequest  true  "Nama, scope dan expires_at (RFC3339, opsional)"
+// @Success      201     {object}  createAPIKeyResponse
+// @Failure      400     {object}  map[string]string
+// @Failure      403     {object}  map[string]string
+// @Failure      500     {object}  map[string]string
+// @Router       /apikeys [post]
+// @Security     BearerAuth
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	key, k, err := utils.CreateAPIKey(r.Context(), req.Name, req.Scopes, req.ExpiresAt, utils.Subject(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	recordAudit(r, repository.EntityAPIKey, k.ID, repository.ActionCreate, utils.Subject(r), map[string]models.FieldChange{
+		"name":   {To: k.Name},
+		"scopes": {To: k.Scopes},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(createAPIKeyResponse{Key: key, APIKey: k})
+}
+
+// ✅ DELETE API Key
+// @Summary      Cabut API key (admin)
+// @Description  Mencabut API key; request berikutnya dengan key ini ditolak
+// @Tags         apikeys
+// @Param        id  path  string  true  "API key ID"
+// @Success      204  "No Content"
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /apikeys/{id} [delete]
+// @Security     BearerAuth
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/apikeys/"), "/")
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	k, err := utils.RevokeAPIKey(r.Context(), id)
+	if errors.Is(err, utils.ErrAPIKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, repository.EntityAPIKey, k.ID, repository.ActionRevoke, utils.Subject(r), map[string]models.FieldChange{
+		"revoked_at": {To: k.RevokedAt},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+func TestAPIKeyAdminEndpoints(t *testing.T) {
+	repo := repository.NewMemoryCharacterRepository()
+	SetCharacterRepository(repo)
+	SetAuditRepository(repo)
+	utils.SetAPIKeyStore(utils.NewMemoryAPIKeyStore())
+	t.Cleanup(func() { utils.SetAPIKeyStore(utils.NewMemoryAPIKeyStore()) })
+	admin := login(t, "admin").Token
+
+	for _, body := range []string{`{`, `{"name":"ci"}`, `{"name":"ci","scopes":["characters:everything"]}`} {
+		if rec := serve(utils.Secure(CreateAPIKey), http.MethodPost, "/api/apikeys", body, admin); rec.Code != http.StatusBadRequest {
+			t.Errorf("create %s: status %d, want 400", body, rec.Code)
+		}
+	}
+
+	rec := serve(utils.Secure(CreateAPIKey), http.MethodPost, "/api/apikeys", `{"name":"importer","scopes":["characters:read"]}`, admin)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+	}
+	var created createAPIKeyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Key == "" || created.APIKey.CreatedBy != "admin" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// the key authenticates until it is revoked
+	useKey := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/characters", nil)
+		req.Header.Set("X-API-Key", created.Key)
+		rec := httptest.NewRecorder()
+		utils.Secure(utils.Require(utils.PermCharactersRead, GetCharacters))(rec, req)
+		return rec.Code
+	}
+	if got := useKey(); got != http.StatusOK {
+		t.Fatalf("new key: status %d", got)
+	}
+
+	rec = serve(utils.Secure(GetAPIKeys), http.MethodGet, "/api/apikeys", "", admin)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("list: status %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), created.Key) || strings.Contains(rec.Body.String(), `"hash"`) {
+		t.Errorf("list exposes the key: %s", rec.Body)
+	}
+	var keys []utils.APIKey
+	if err := json.NewDecoder(rec.Body).Decode(&keys); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != created.APIKey.ID || keys[0].RevokedAt != nil {
+		t.Fatalf("list = %+v", keys)
+	}
+
+	if rec := serve(utils.Secure(RevokeAPIKey), http.MethodDelete, "/api/apikeys/"+created.APIKey.ID, "", admin); rec.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status %d: %s", rec.Code, rec.Body)
+	}
+	if got := useKey(); got != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", got)
+	}
+	if rec := serve(utils.Secure(RevokeAPIKey), http.MethodDelete, "/api/apikeys/missing", "", admin); rec.Code != http.StatusNotFound {
+		t.Errorf("revoke unknown key: status %d, want 404", rec.Code)
+	}
+
+	entries, err := repo.ListAudit(context.Background(), repository.AuditFilter{Entity: repository.EntityAPIKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != repository.ActionRevoke || entries[1].Action != repository.ActionCreate {
+		t.Errorf("audit entries = %+v, want revoke and create", entries)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"go-rest/models"
+	"go-rest/repository"
+)
+
+// auditRepo is the storage backend of the audit trail
+var auditRepo repository.AuditRepository
+
+// SetAuditRepository selects the storage backend of the audit trail
+func SetAuditRepository(repo repository.AuditRepository) {
+	auditRepo = repo
+}
+
+// ✅ GET Character History
+// @Summary      Riwayat perubahan karakter
+// @Description  Daftar audit (create, update, delete, restore, purge) sebuah karakter, terbaru lebih dulu
+// @Tags         audit
+// @Produce      json
+// @Param        id      path      int  true   "Character ID"
+// @Param        limit   query     int  false  "Jumlah item (default 50, maks 500)"
+// @Param        offset  query     int  false  "Jumlah item yang dilewati"
+// @Success      200  {array}   models.AuditEntry
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /characters/{id}/history [get]
+// @Security     BearerAuth
+func GetCharacterHistory(w http.ResponseWriter, r *http.Request) {
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter.Entity = repository.EntityCharacter
+	filter.EntityID = strconv.Itoa(id)
+
+	entries, err := auditRepo.ListAudit(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// ✅ GET Audit Log
+// @Summary      Query audit trail (admin)
+// @Description  Semua entri audit dengan filter, terbaru lebih dulu
+// @Tags         audit
+// @Produce      json
+// @Param        entity     query     string  false  "Jenis entity, mis. character"
+// @Param        entity_id  query     string  false  "ID entity"
+// @Param        actor      query     string  false  "Username pelaku"
+// @Param        action     query     string  false  "create, update, delete, restore, purge"
+// @Param        since      query     string  false  "Sejak waktu ini (RFC3339 atau YYYY-MM-DD)"
+// @Param        until      query     string  false  "Sebelum waktu ini (RFC3339 atau YYYY-MM-DD)"
+// @Param        limit      query     int     false  "Jumlah item (default 50, maks 500)"
+// @Param        offset     query     int     false  "Jumlah item yang dilewati"
+// @Success      200  {array}   models.AuditEntry
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /audit [get]
+// @Security     BearerAuth
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseAuditFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := auditRepo.ListAudit(r.Context(), filter)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(entries)
+}
+
+// parseAuditFilter reads the audit query parameters
+func parseAuditFilter(q url.Values) (repository.AuditFilter, error) {
+	f := repository.AuditFilter{
+		Entity:   q.Get("entity"),
+		EntityID: q.Get("entity_id"),
+		Actor:    q.Get("actor"),
+		Action:   q.Get("action"),
+	}
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil || f.Limit < 1 {
+			return f, errors.New("invalid limit")
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if f.Offset, err = strconv.Atoi(v); err != nil || f.Offset < 0 {
+			return f, errors.New("invalid offset")
+		}
+	}
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = parseTimeParam(v); err != nil {
+			return f, errors.New("invalid since")
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = parseTimeParam(v); err != nil {
+			return f, errors.New("invalid until")
+		}
+	}
+	return f, nil
+}
+
+// recordAudit writes an audit entry for an event outside the character repository.
+// The event already happened, so failures are only logged.
+func recordAudit(r *http.Request, entity, entityID, action, actor string, changes map[string]models.FieldChange) {
+	if auditRepo == nil {
+		return
+	}
+	err := auditRepo.RecordAudit(r.Context(), models.AuditEntry{
+		Entity:   entity,
+		EntityID: entityID,
+		Action:   action,
+		Actor:    actor,
+		Changes:  changes,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "audit record failed",
+			"action", action, "entity", entity, "entity_id", entityID, "error", err)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"go-rest/models"
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+func TestCharacterMutationsAreAudited(t *testing.T) {
+	useFreshRepository(t)
+	editor, admin := login(t, "editor").Token, login(t, "admin").Token
+	as := func(handler http.HandlerFunc, method, target, body, token string) {
+		t.Helper()
+		rec := serve(utils.Secure(handler), method, target, body, token)
+		if rec.Code >= 300 {
+			t.Fatalf("%s %s: status %d: %s", method, target, rec.Code, rec.Body)
+		}
+	}
+	as(CreateCharacter, http.MethodPost, "/api/characters", `{"name":"Hero","role":"mage","game":"Quest"}`, editor)
+	as(UpdateCharacter, http.MethodPut, "/api/characters/1", `{"name":"Hero","role":"healer","game":"Quest"}`, editor)
+	as(DeleteCharacter, http.MethodDelete, "/api/characters/1", "", admin)
+	as(RestoreCharacter, http.MethodPost, "/api/characters/1/restore", "", editor)
+	as(PurgeCharacter, http.MethodDelete, "/api/characters/1/purge", "", admin)
+
+	rec := serve(GetCharacterHistory, http.MethodGet, "/api/characters/1/history", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("history: status %d: %s", rec.Code, rec.Body)
+	}
+	var entries []models.AuditEntry
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		action, actor string
+		changed       []string
+	}{
+		{repository.ActionPurge, "admin", []string{"name", "role", "game"}},
+		{repository.ActionRestore, "editor", []string{"deleted_at"}},
+		{repository.ActionDelete, "admin", []string{"deleted_at"}},
+		{repository.ActionUpdate, "editor", []string{"role"}},
+		{repository.ActionCreate, "editor", []string{"name", "role", "game"}},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("got %d history entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		e := entries[i]
+		if e.Action != w.action || e.Actor != w.actor || e.Entity != repository.EntityCharacter || e.EntityID != "1" {
+			t.Errorf("entry %d = %s by %s on %s %s, want %s by %s", i, e.Action, e.Actor, e.Entity, e.EntityID, w.action, w.actor)
+		}
+		if len(e.Changes) != len(w.changed) {
+			t.Errorf("%s changes = %v, want fields %v", e.Action, e.Changes, w.changed)
+		}
+		for _, field := range w.changed {
+			if _, ok := e.Changes[field]; !ok {
+				t.Errorf("%s changes = %v, missing %s", e.Action, e.Changes, field)
+			}
+		}
+	}
+	if c := entries[3].Changes["role"]; c.From != "mage" || c.To != "healer" {
+		t.Errorf("update role change = %+v, want mage -> healer", c)
+	}
+	if c := entries[4].Changes["name"]; c.From != nil || c.To != "Hero" {
+		t.Errorf("create name change = %+v, want nil -> Hero", c)
+	}
+	if c := entries[0].Changes["name"]; c.From != "Hero" || c.To != nil {
+		t.Errorf("purge name change = %+v, want Hero -> nil", c)
+	}
+
+	// the audit log filters by actor and action
+	rec = serve(GetAuditLog, http.MethodGet, "/api/audit?actor=admin&action=delete", "", "")
+	entries = nil
+	if err := json.NewDecoder(rec.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Action != repository.ActionDelete {
+		t.Errorf("audit?actor=admin&action=delete = %+v, want the delete only", entries)
+	}
+}
+
+func TestParseAuditFilter(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr string
+	}{
+		{"entity=character&entity_id=1&actor=admin&action=update&limit=5&offset=10&since=2024-01-01&until=2024-02-01T00:00:00Z", ""},
+		{"limit=0", "invalid limit"},
+		{"limit=ten", "invalid limit"},
+		{"offset=-1", "invalid offset"},
+		{"offset=x", "invalid offset"},
+		{"since=yesterday", "invalid since"},
+		{"until=2024-13-01", "invalid until"},
+	}
+	for _, tt := range tests {
+		q, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := parseAuditFilter(q)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: err = %v, want %q", tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.query, err)
+			continue
+		}
+		if f.Entity != "character" || f.EntityID != "1" || f.Actor != "admin" || f.Action != "update" ||
+			f.Limit != 5 || f.Offset != 10 || f.Since.IsZero() || f.Until.IsZero() {
+			t.Errorf("%s: filter = %+v", tt.query, f)
+		}
+	}
+
+	// bad filters are answered with 400
+	if rec := serve(GetAuditLog, http.MethodGet, "/api/audit?since=yesterday", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /api/audit?since=yesterday: status %d, want 400", rec.Code)
+	}
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"go-rest/models"
+	"go-rest/repository"
 	"go-rest/utils"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -26,6 +30,7 @@ type tokenResponse struct {
 // @Success      200          {object}  tokenResponse
 // @Failure      400          {object}  map[string]string
 // @Failure      401          {object}  map[string]string
+// @Failure      429          {object}  map[string]string  "Terlalu banyak percobaan gagal, lihat header Retry-After"
 // @Router       /login [post]
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -37,20 +42,26 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	ip := utils.ClientIP(r)
+	if wait, ok := utils.LoginAllowed(req.Username, ip); !ok {
+		tooManyAttempts(w, wait)
+		return
+	}
 	if !utils.Authenticate(req.Username, req.Password) {
+		changes := map[string]models.FieldChange{"ip": {To: ip}}
+		recordAudit(r, repository.EntityUser, req.Username, repository.ActionLoginFailed, req.Username, changes)
+		if utils.LoginFailed(req.Username, ip) {
+			recordAudit(r, repository.EntityUser, req.Username, repository.ActionLockout, "system", changes)
+		}
 		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
 		return
 	}
-	Token, err := utils.CreateToken(req.Username)
+	utils.LoginSucceeded(req.Username, ip)
+	Token, refresh, err := utils.IssueTokens(r.Context(), req.Username, utils.RefreshMetaFromRequest(r))
 	if err != nil {
 		http.Error(w, "Failed to create token", http.StatusInternalServerError)
 		return
 	}
-	refresh, err := utils.CreateRefreshToken(req.Username)
-	if err != nil {
-		http.Error(w, "Failed to create refresh token", http.StatusInternalServerError)
-		return
-	}
 	// set cookies so browser requests (no custom headers) can access protected endpoints
 	http.SetCookie(w, &http.Cookie{Name: "access_token", Value: Token, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
 	http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: refresh, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
@@ -76,21 +87,25 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	utils.InvalidateToken(token)
+	if err := utils.InvalidateToken(r.Context(), token); err != nil {
+		http.Error(w, "Failed to revoke token", http.StatusInternalServerError)
+		return
+	}
 	// clear auth cookies
 	http.SetCookie(w, &http.Cookie{Name: "access_token", Value: "", Path: "/", Expires: time.Unix(0, 0), MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
 	http.SetCookie(w, &http.Cookie{Name: "refresh_token", Value: "", Path: "/", Expires: time.Unix(0, 0), MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// @Summary      Logout
-// @Description  Logout user, menghapus access token & refresh token (client-side dan cookie akan dihapus)
+// @Summary      Refresh token
+// @Description  Menukar refresh token dengan access token + refresh token baru (refresh token lama langsung tidak berlaku)
 // @Tags         auth
+// @Accept       json
 // @Produce      json
-// @Success      204  "No Content"
+// @Success      200  {object}  tokenResponse
+// @Failure      400  {object}  map[string]string
 // @Failure      401  {object}  map[string]string
-// @Router       /logout [post]
-// @Security     BearerAuth
+// @Router       /refresh [post]
 func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -103,7 +118,7 @@ func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
-	access, refresh, err := utils.ValidateAndRotateRefresh(body.Refresh)
+	access, refresh, err := utils.ValidateAndRotateRefresh(r.Context(), body.Refresh, utils.RefreshMetaFromRequest(r))
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
@@ -114,3 +129,9 @@ func RefreshHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tokenResponse{Token: access, Refresh: refresh})
 }
+
+// tooManyAttempts answers 429 with Retry-After in whole seconds
+func tooManyAttempts(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"go-rest/utils"
+)
+
+func TestLoginConcurrentGuessesAreThrottled(t *testing.T) {
+	const attempts = 20
+	var wg sync.WaitGroup
+	codes := make(chan int, attempts)
+	for range attempts {
+		wg.Go(func() {
+			rec := serve(LoginHandler, http.MethodPost, "/api/login", `{"username":"brute","password":"wrong"}`, "")
+			codes <- rec.Code
+		})
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	// only the free attempts may reach the password check, the rest must wait
+	if free := utils.DefaultLoginPolicy.FreeAttempts; counts[http.StatusUnauthorized] != free {
+		t.Errorf("got %d password checks, want %d (codes %v)", counts[http.StatusUnauthorized], free, counts)
+	}
+	if counts[http.StatusTooManyRequests] != attempts-utils.DefaultLoginPolicy.FreeAttempts {
+		t.Errorf("got %d 429 responses, want %d (codes %v)", counts[http.StatusTooManyRequests],
+			attempts-utils.DefaultLoginPolicy.FreeAttempts, counts)
+	}
+}
+
+func TestLogoutRevokesRefreshToken(t *testing.T) {
+	tokens := login(t, "logout")
+	if rec := serve(LogoutHandler, http.MethodPost, "/api/logout", "", tokens.Token); rec.Code != http.StatusNoContent {
+		t.Fatalf("logout: status %d: %s", rec.Code, rec.Body)
+	}
+	rec := serve(RefreshHandler, http.MethodPost, "/api/refresh", `{"refresh":"`+tokens.Refresh+`"}`, "")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh after logout: status %d, want 401", rec.Code)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	tokens := login(t, "reuse")
+	refresh := func(token string) *httptest.ResponseRecorder {
+		return serve(RefreshHandler, http.MethodPost, "/api/refresh", `{"refresh":"`+token+`"}`, "")
+	}
+
+	rotated := refresh(tokens.Refresh)
+	if rotated.Code != http.StatusOK {
+		t.Fatalf("first refresh: status %d: %s", rotated.Code, rotated.Body)
+	}
+	var next tokenResponse
+	if err := json.NewDecoder(rotated.Body).Decode(&next); err != nil {
+		t.Fatal(err)
+	}
+
+	// replaying the rotated token looks like theft: the whole family is revoked
+	if rec := refresh(tokens.Refresh); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed refresh token: status %d, want 401", rec.Code)
+	}
+	if rec := refresh(next.Refresh); rec.Code != http.StatusUnauthorized {
+		t.Errorf("refresh token of revoked family: status %d, want 401", rec.Code)
+	}
+	secured := utils.Secure(func(w http.ResponseWriter, r *http.Request) {})
+	if rec := serve(secured, http.MethodGet, "/api/characters", "", next.Token); rec.Code != http.StatusUnauthorized {
+		t.Errorf("access token of revoked family: status %d, want 401", rec.Code)
+	}
+}
@@ -1,74 +1,258 @@
 package handlers
 
 import (
-    "context"
-    "encoding/json"
-    "net/http"
-    "strconv"
-    "strings"
-
-    "go-rest/config"
-    "go-rest/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-rest/models"
+	"go-rest/repository"
+	"go-rest/utils"
 )
 
+// characterRepo is the storage backend used by the character handlers
+var characterRepo repository.CharacterRepository
+
+// SetCharacterRepository selects the storage backend (PostgreSQL or in-memory)
+func SetCharacterRepository(repo repository.CharacterRepository) {
+	characterRepo = repo
+}
+
+// actorContext tags the request context with the authenticated user for the audit trail
+func actorContext(r *http.Request) context.Context {
+	return repository.WithActor(r.Context(), utils.Subject(r))
+}
+
+// parseCharacterPath splits /api/characters/{id}[/{action}] into ID and action
+func parseCharacterPath(path string) (int, string, error) {
+	rest := strings.TrimPrefix(path, "/api/characters/")
+	idStr, action, _ := strings.Cut(rest, "/")
+	id, err := strconv.Atoi(idStr)
+	return id, action, err
+}
+
+// CharacterAction returns the sub-resource of /api/characters/{id}/{action}, or "" for the character itself
+func CharacterAction(r *http.Request) string {
+	_, action, _ := parseCharacterPath(r.URL.Path)
+	return action
+}
+
 // ✅ GET All Characters
 // @Summary      Ambil semua karakter game
-// @Description  Mendapatkan list semua karakter dari database
+// @Description  Mendapatkan list karakter dari database dengan pagination (limit/offset atau cursor), filter dan sorting.
+// @Description  Metadata pagination dikirim lewat header X-Total-Count, X-Next-Cursor dan Link.
 // @Tags         characters
 // @Produce      json
+// @Param        limit           query     int     false  "Jumlah item per halaman (default 50, maks 500)"
+// @Param        offset          query     int     false  "Jumlah item yang dilewati"
+// @Param        cursor          query     string  false  "Cursor halaman berikutnya (dari header X-Next-Cursor)"
+// @Param        role            query     string  false  "Filter role (case-insensitive)"
+// @Param        game            query     string  false  "Filter game (case-insensitive)"
+// @Param        created_after   query     string  false  "Dibuat pada/sesudah waktu ini (RFC3339 atau YYYY-MM-DD)"
+// @Param        created_before  query     string  false  "Dibuat sebelum waktu ini (RFC3339 atau YYYY-MM-DD)"
+// @Param        sort            query     string  false  "Kolom sort: id, name, role, game, created_at, updated_at; awali dengan '-' untuk descending"
 // @Success      200  {array}   models.Character
+// @Header       200  {integer}  X-Total-Count  "Jumlah total karakter yang cocok dengan filter"
+// @Header       200  {string}   X-Next-Cursor  "Cursor untuk halaman berikutnya, kosong jika halaman terakhir"
+// @Header       200  {string}   Link           "Link first/prev/next (RFC 8288)"
+// @Failure      400  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /characters [get]
 func GetCharacters(w http.ResponseWriter, r *http.Request) {
-    ctx := context.Background()
-    rows, err := config.DB.Query(ctx, "SELECT id, name, role, game FROM characters")
-    if err != nil {
-        http.Error(w, "Database error", http.StatusInternalServerError)
-        return
-    }
-    defer rows.Close()
-
-    var characters []models.Character
-    for rows.Next() {
-        var c models.Character
-        if err := rows.Scan(&c.ID, &c.Name, &c.Role, &c.Game); err != nil {
-            http.Error(w, "Error scanning data", http.StatusInternalServerError)
-            return
-        }
-        characters = append(characters, c)
-    }
-
-    json.NewEncoder(w).Encode(characters)
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := characterRepo.List(r.Context(), opts)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	if links := paginationLinks(r.URL, opts, page); links != "" {
+		w.Header().Set("Link", links)
+	}
+	json.NewEncoder(w).Encode(page.Items)
+}
+
+// parseListOptions reads pagination, filter and sort query parameters
+func parseListOptions(q url.Values) (repository.ListOptions, error) {
+	opts := repository.ListOptions{
+		Role: q.Get("role"),
+		Game: q.Get("game"),
+	}
+
+	var err error
+	if v := q.Get("limit"); v != "" {
+		if opts.Limit, err = strconv.Atoi(v); err != nil || opts.Limit < 1 {
+			return opts, errors.New("invalid limit")
+		}
+	}
+	if v := q.Get("offset"); v != "" {
+		if opts.Offset, err = strconv.Atoi(v); err != nil || opts.Offset < 0 {
+			return opts, errors.New("invalid offset")
+		}
+	}
+	if v := q.Get("created_after"); v != "" {
+		if opts.CreatedAfter, err = parseTimeParam(v); err != nil {
+			return opts, errors.New("invalid created_after")
+		}
+	}
+	if v := q.Get("created_before"); v != "" {
+		if opts.CreatedBefore, err = parseTimeParam(v); err != nil {
+			return opts, errors.New("invalid created_before")
+		}
+	}
+
+	opts.Sort = q.Get("sort")
+	if strings.HasPrefix(opts.Sort, "-") {
+		opts.Sort = opts.Sort[1:]
+		opts.Desc = true
+	}
+	if v := q.Get("cursor"); v != "" {
+		if opts.Offset > 0 {
+			return opts, errors.New("cursor and offset cannot be combined")
+		}
+		if opts.Cursor, err = repository.DecodeCursor(v); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, opts.Normalize()
+}
+
+// parseTimeParam accepts RFC3339 timestamps or plain YYYY-MM-DD dates
+func parseTimeParam(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
+
+// paginationLinks builds the RFC 8288 Link header for a page of characters
+func paginationLinks(u *url.URL, opts repository.ListOptions, page repository.Page) string {
+	link := func(rel string, set func(q url.Values)) string {
+		q := u.Query()
+		q.Del("cursor")
+		q.Del("offset")
+		q.Set("limit", strconv.Itoa(opts.Limit))
+		set(q)
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, q.Encode(), rel)
+	}
+
+	links := []string{link("first", func(url.Values) {})}
+	if opts.Offset > 0 {
+		prev := max(opts.Offset-opts.Limit, 0)
+		links = append(links, link("prev", func(q url.Values) {
+			if prev > 0 {
+				q.Set("offset", strconv.Itoa(prev))
+			}
+		}))
+	}
+	if page.NextCursor != "" {
+		links = append(links, link("next", func(q url.Values) {
+			if opts.Offset > 0 {
+				q.Set("offset", strconv.Itoa(opts.Offset+opts.Limit))
+			} else {
+				q.Set("cursor", page.NextCursor)
+			}
+		}))
+	}
+	return strings.Join(links, ", ")
+}
+
+// ✅ SEARCH Characters
+// @Summary      Cari karakter
+// @Description  Full-text search dengan ranking pada name, role dan game (prefix match per kata).
+// @Description  Jika tidak ada hasil, pencarian fuzzy berbasis trigram dipakai sehingga typo seperti "Naurto" tetap menemukan "Naruto Uzumaki".
+// @Description  Kata yang cocok ditandai dengan <mark></mark> di field highlights; teks lainnya sudah di-escape HTML.
+// @Tags         characters
+// @Produce      json
+// @Param        q      query     string  true   "Kata kunci pencarian"
+// @Param        limit  query     int     false  "Jumlah hasil maksimum (default 20, maks 500)"
+// @Success      200  {array}   models.CharacterSearchResult
+// @Failure      400  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /characters/search [get]
+// @Security     BearerAuth
+func SearchCharacters(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	if q == "" {
+		http.Error(w, "Missing query parameter q", http.StatusBadRequest)
+		return
+	}
+	limit := repository.DefaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, repository.MaxLimit)
+	}
+
+	results, err := characterRepo.Search(r.Context(), q, limit)
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(results)
 }
 
 // ✅ GET Character by ID
 // @Summary      Ambil karakter berdasarkan ID
 // @Tags         characters
 // @Produce      json
-// @Param        id   path      int  true  "Character ID"
+// @Description  Response membawa header ETag; kirim If-None-Match untuk mendapat 304 jika belum berubah
+// @Param        id             path      int     true   "Character ID"
+// @Param        If-None-Match  header    string  false  "ETag yang sudah dimiliki client"
 // @Success      200  {object}  models.Character
+// @Success      304  "Not Modified"
 // @Failure      400  {object}  map[string]string
 // @Failure      404  {object}  map[string]string
 // @Router       /characters/{id} [get]
 func GetCharacterByID(w http.ResponseWriter, r *http.Request) {
-    ctx := context.Background()
-    idStr := strings.TrimPrefix(r.URL.Path, "/api/characters/")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        http.Error(w, "Invalid ID", http.StatusBadRequest)
-        return
-    }
-
-    var c models.Character
-    err = config.DB.QueryRow(ctx,
-        "SELECT id, name, role, game FROM characters WHERE id=$1", id,
-    ).Scan(&c.ID, &c.Name, &c.Role, &c.Game)
-
-    if err != nil {
-        http.Error(w, "Character not found", http.StatusNotFound)
-        return
-    }
-    json.NewEncoder(w).Encode(c)
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	c, err := characterRepo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Character not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && etagMatches(inm, characterETag(c), true) {
+		w.Header().Set("ETag", characterETag(c))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	writeCharacter(w, http.StatusOK, c)
 }
 
 // ✅ CREATE Character
@@ -79,28 +263,26 @@ func GetCharacterByID(w http.ResponseWriter, r *http.Request) {
 // @Param        character  body      models.Character  true  "Character Data"
 // @Success      201  {object}  models.Character
 // @Failure      400  {object}  map[string]string
+// @Failure      422  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /characters [post]
 func CreateCharacter(w http.ResponseWriter, r *http.Request) {
-    ctx := context.Background()
-    var character models.Character
-    if err := json.NewDecoder(r.Body).Decode(&character); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
-        return
-    }
+	var character models.Character
+	if err := json.NewDecoder(r.Body).Decode(&character); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateCharacter(character); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 
-    err := config.DB.QueryRow(ctx,
-        "INSERT INTO characters (name, role, game) VALUES ($1, $2, $3) RETURNING id",
-        character.Name, character.Role, character.Game,
-    ).Scan(&character.ID)
+	if err := characterRepo.Create(actorContext(r), &character); err != nil {
+		http.Error(w, "Failed to insert", http.StatusInternalServerError)
+		return
+	}
 
-    if err != nil {
-        http.Error(w, "Failed to insert", http.StatusInternalServerError)
-        return
-    }
-
-    w.WriteHeader(http.StatusCreated)
-    json.NewEncoder(w).Encode(character)
+	writeCharacter(w, http.StatusCreated, character)
 }
 
 // ✅ UPDATE Character
@@ -108,62 +290,309 @@ func CreateCharacter(w http.ResponseWriter, r *http.Request) {
 // @Tags         characters
 // @Accept       json
 // @Produce      json
-// @Param        id         path      int                true  "Character ID"
-// @Param        character  body      models.Character  true  "Character Data"
+// @Param        id         path      int                true   "Character ID"
+// @Param        If-Match   header    string             false  "ETag dari response sebelumnya"
+// @Param        character  body      models.Character  true   "Character Data"
 // @Success      200  {object}  models.Character
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      412  {object}  map[string]string
+// @Failure      422  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /characters/{id} [put]
 func UpdateCharacter(w http.ResponseWriter, r *http.Request) {
-    ctx := context.Background()
-    idStr := strings.TrimPrefix(r.URL.Path, "/api/characters/")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        http.Error(w, "Invalid ID", http.StatusBadRequest)
-        return
-    }
-
-    var character models.Character
-    if err := json.NewDecoder(r.Body).Decode(&character); err != nil {
-        http.Error(w, "Invalid JSON", http.StatusBadRequest)
-        return
-    }
-
-    _, err = config.DB.Exec(ctx,
-        "UPDATE characters SET name=$1, role=$2, game=$3 WHERE id=$4",
-        character.Name, character.Role, character.Game, id,
-    )
-    if err != nil {
-        http.Error(w, "Failed to update", http.StatusInternalServerError)
-        return
-    }
-
-    character.ID = id
-    json.NewEncoder(w).Encode(character)
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var character models.Character
+	if err := json.NewDecoder(r.Body).Decode(&character); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validateCharacter(character); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	version, ok := checkIfMatch(w, r, id)
+	if !ok {
+		return
+	}
+
+	character.ID = id
+	if err := characterRepo.Update(actorContext(r), &character, version); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			http.Error(w, "Character not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeConflict(w, r, id)
+		default:
+			http.Error(w, "Failed to update", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeCharacter(w, http.StatusOK, character)
+}
+
+// validateCharacter checks the fields a character must always have
+func validateCharacter(c models.Character) error {
+	switch {
+	case strings.TrimSpace(c.Name) == "":
+		return errors.New("name is required")
+	case strings.TrimSpace(c.Role) == "":
+		return errors.New("role is required")
+	case strings.TrimSpace(c.Game) == "":
+		return errors.New("game is required")
+	}
+	return nil
+}
+
+// changedReadOnlyField returns the JSON name of the first server-managed field
+// that differs between current and patched, or "" if none was touched
+func changedReadOnlyField(current, patched models.Character) string {
+	switch {
+	case patched.ID != current.ID:
+		return "id"
+	case patched.Version != current.Version:
+		return "version"
+	case !patched.CreatedAt.Equal(current.CreatedAt):
+		return "created_at"
+	case !patched.UpdatedAt.Equal(current.UpdatedAt):
+		return "updated_at"
+	case patched.DeletedAt != nil:
+		return "deleted_at"
+	}
+	return ""
+}
+
+// ✅ PATCH Character
+// @Summary      Update sebagian field karakter
+// @Description  Mendukung JSON Merge Patch (application/merge-patch+json, RFC 7396)
+// @Description  dan JSON Patch (application/json-patch+json, RFC 6902). Hasil patch divalidasi sebelum disimpan;
+// @Description  field id, version, created_at, updated_at dan deleted_at tidak boleh diubah (422).
+// @Tags         characters
+// @Accept       application/merge-patch+json
+// @Accept       application/json-patch+json
+// @Produce      json
+// @Param        id        path      int     true   "Character ID"
+// @Param        If-Match  header    string  false  "ETag dari response sebelumnya"
+// @Param        patch     body      object  true   "Merge patch object atau array operasi JSON Patch"
+// @Success      200  {object}  models.Character
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      409  {object}  map[string]string
+// @Failure      412  {object}  map[string]string
+// @Failure      415  {object}  map[string]string
+// @Failure      422  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /characters/{id} [patch]
+// @Security     BearerAuth
+func PatchCharacter(w http.ResponseWriter, r *http.Request) {
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var apply func(doc, patch []byte) ([]byte, error)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/merge-patch+json":
+		apply = utils.MergePatch
+	case "application/json-patch+json":
+		apply = utils.ApplyJSONPatch
+	default:
+		w.Header().Set("Accept-Patch", "application/merge-patch+json, application/json-patch+json")
+		http.Error(w, "Unsupported patch format", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+
+	current, err := characterRepo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Character not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if im := r.Header.Get("If-Match"); im != "" && !etagMatches(im, characterETag(current), false) {
+		preconditionFailed(w, current)
+		return
+	}
+
+	doc, _ := json.Marshal(current)
+	patched, err := apply(doc, patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrPatchTestFailed):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, utils.ErrInvalidPatch):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Failed to apply patch", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var character models.Character
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&character); err != nil {
+		http.Error(w, "Invalid patched character: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if field := changedReadOnlyField(current, character); field != "" {
+		http.Error(w, field+" is read-only", http.StatusUnprocessableEntity)
+		return
+	}
+	if err := validateCharacter(character); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// the patch was computed from current, so only apply it to that exact version
+	if err := characterRepo.Update(actorContext(r), &character, current.Version); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			http.Error(w, "Character not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeConflict(w, r, id)
+		default:
+			http.Error(w, "Failed to update", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	writeCharacter(w, http.StatusOK, character)
 }
 
 // ✅ DELETE Character
 // @Summary      Hapus karakter
+// @Description  Soft delete: karakter dipindah ke trash dan bisa di-restore
 // @Tags         characters
-// @Param        id   path      int  true  "Character ID"
+// @Param        id        path      int     true   "Character ID"
+// @Param        If-Match  header    string  false  "ETag dari response sebelumnya"
 // @Success      204  "No Content"
 // @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      412  {object}  map[string]string
 // @Failure      500  {object}  map[string]string
 // @Router       /characters/{id} [delete]
 func DeleteCharacter(w http.ResponseWriter, r *http.Request) {
-    ctx := context.Background()
-    idStr := strings.TrimPrefix(r.URL.Path, "/api/characters/")
-    id, err := strconv.Atoi(idStr)
-    if err != nil {
-        http.Error(w, "Invalid ID", http.StatusBadRequest)
-        return
-    }
-
-    _, err = config.DB.Exec(ctx, "DELETE FROM characters WHERE id=$1", id)
-    if err != nil {
-        http.Error(w, "Failed to delete", http.StatusInternalServerError)
-        return
-    }
-
-    w.WriteHeader(http.StatusNoContent)
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := checkIfMatch(w, r, id)
+	if !ok {
+		return
+	}
+
+	if err := characterRepo.Delete(actorContext(r), id, version); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			http.Error(w, "Character not found", http.StatusNotFound)
+		case errors.Is(err, repository.ErrVersionConflict):
+			writeConflict(w, r, id)
+		default:
+			http.Error(w, "Failed to delete", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ✅ GET Deleted Characters
+// @Summary      Ambil karakter yang ada di trash
+// @Description  Mendapatkan list karakter yang sudah di-soft delete
+// @Tags         characters
+// @Produce      json
+// @Success      200  {array}   models.Character
+// @Failure      500  {object}  map[string]string
+// @Router       /characters/trash [get]
+// @Security     BearerAuth
+func GetDeletedCharacters(w http.ResponseWriter, r *http.Request) {
+	characters, err := characterRepo.ListDeleted(r.Context())
+	if err != nil {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(characters)
+}
+
+// ✅ RESTORE Character
+// @Summary      Restore karakter dari trash
+// @Tags         characters
+// @Produce      json
+// @Param        id   path      int  true  "Character ID"
+// @Success      200  {object}  models.Character
+// @Failure      400  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /characters/{id}/restore [post]
+// @Security     BearerAuth
+func RestoreCharacter(w http.ResponseWriter, r *http.Request) {
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	c, err := characterRepo.Restore(actorContext(r), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Character not found in trash", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to restore", http.StatusInternalServerError)
+		return
+	}
+
+	writeCharacter(w, http.StatusOK, c)
+}
+
+// ✅ PURGE Character
+// @Summary      Hapus karakter secara permanen (admin)
+// @Tags         characters
+// @Param        id   path      int  true  "Character ID"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Failure      404  {object}  map[string]string
+// @Failure      500  {object}  map[string]string
+// @Router       /characters/{id}/purge [delete]
+// @Security     BearerAuth
+func PurgeCharacter(w http.ResponseWriter, r *http.Request) {
+	id, _, err := parseCharacterPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := characterRepo.Purge(actorContext(r), id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Character not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to purge", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
 }
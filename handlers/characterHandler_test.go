@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go-rest/models"
+	"go-rest/repository"
+)
+
+// createCharacters stores n characters named Hero 1..n
+func createCharacters(t *testing.T, n int) {
+	t.Helper()
+	for i := 1; i <= n; i++ {
+		body := fmt.Sprintf(`{"name":"Hero %d","role":"mage","game":"Quest"}`, i)
+		if rec := serve(CreateCharacter, http.MethodPost, "/api/characters", body, ""); rec.Code != http.StatusCreated {
+			t.Fatalf("create: status %d: %s", rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestGetCharactersCursorPagination(t *testing.T) {
+	useFreshRepository(t)
+	createCharacters(t, 7)
+
+	var ids []int
+	target := "/api/characters?limit=3"
+	for pages := 0; target != ""; pages++ {
+		if pages > 3 {
+			t.Fatal("pagination does not end")
+		}
+		rec := serve(GetCharacters, http.MethodGet, target, "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+		}
+		if got := rec.Header().Get("X-Total-Count"); got != "7" {
+			t.Errorf("X-Total-Count = %q, want 7", got)
+		}
+		var items []models.Character
+		if err := json.NewDecoder(rec.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range items {
+			ids = append(ids, c.ID)
+		}
+
+		target = ""
+		if cursor := rec.Header().Get("X-Next-Cursor"); cursor != "" {
+			if !strings.Contains(rec.Header().Get("Link"), `rel="next"`) {
+				t.Errorf("Link header without next: %q", rec.Header().Get("Link"))
+			}
+			target = "/api/characters?limit=3&cursor=" + url.QueryEscape(cursor)
+		}
+	}
+
+	want := []int{1, 2, 3, 4, 5, 6, 7}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("paged IDs %v, want %v", ids, want)
+	}
+}
+
+func TestGetCharactersInvalidCursor(t *testing.T) {
+	useFreshRepository(t)
+	createCharacters(t, 2)
+	tests := []struct {
+		name, sort, cursor string
+	}{
+		{"not base64", "id", "not-a-cursor"},
+		{"unknown sort", "id", repository.EncodeCursor(repository.Cursor{Sort: "password", Value: "x", ID: 1})},
+		{"other sort", "created_at", repository.EncodeCursor(repository.Cursor{Sort: "name", Value: "Hero 1", ID: 1})},
+		{"non-timestamp value", "created_at", repository.EncodeCursor(repository.Cursor{Sort: "created_at", Value: "yesterday", ID: 1})},
+		{"injected value", "updated_at", repository.EncodeCursor(repository.Cursor{Sort: "updated_at", Value: "'; DROP TABLE characters; --", ID: 1})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(GetCharacters, http.MethodGet, "/api/characters?sort="+tt.sort+"&cursor="+url.QueryEscape(tt.cursor), "", "")
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+}
+
+// patchCharacter sends a patch of the given media type to character 1
+func patchCharacter(mediaType, patch string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, "/api/characters/1", strings.NewReader(patch))
+	req.Header.Set("Content-Type", mediaType)
+	rec := httptest.NewRecorder()
+	PatchCharacter(rec, req)
+	return rec
+}
+
+func TestPatchCharacterReadOnlyFields(t *testing.T) {
+	useFreshRepository(t)
+	createCharacters(t, 1)
+
+	tests := []struct {
+		name, mediaType, patch string
+		want                   int
+	}{
+		{"merge name", "application/merge-patch+json", `{"name":"Renamed"}`, http.StatusOK},
+		{"merge id", "application/merge-patch+json", `{"id":42}`, http.StatusUnprocessableEntity},
+		{"merge version", "application/merge-patch+json", `{"version":99}`, http.StatusUnprocessableEntity},
+		{"merge created_at", "application/merge-patch+json", `{"created_at":"2000-01-01T00:00:00Z"}`, http.StatusUnprocessableEntity},
+		{"merge updated_at", "application/merge-patch+json", `{"updated_at":"2000-01-01T00:00:00Z"}`, http.StatusUnprocessableEntity},
+		{"merge deleted_at", "application/merge-patch+json", `{"deleted_at":"2000-01-01T00:00:00Z"}`, http.StatusUnprocessableEntity},
+		{"json patch version", "application/json-patch+json", `[{"op":"replace","path":"/version","value":99}]`, http.StatusUnprocessableEntity},
+		{"json patch created_at", "application/json-patch+json", `[{"op":"remove","path":"/created_at"}]`, http.StatusUnprocessableEntity},
+		{"empty name", "application/merge-patch+json", `{"name":" "}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := patchCharacter(tt.mediaType, tt.patch); rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+func TestCreateAndUpdateValidateCharacter(t *testing.T) {
+	useFreshRepository(t)
+	createCharacters(t, 1)
+
+	invalid := []string{
+		`{"role":"mage","game":"Quest"}`,
+		`{"name":"Hero","role":"","game":"Quest"}`,
+		`{"name":"Hero","role":"mage","game":"   "}`,
+	}
+	for _, body := range invalid {
+		if rec := serve(CreateCharacter, http.MethodPost, "/api/characters", body, ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("POST %s: status %d, want 422", body, rec.Code)
+		}
+		if rec := serve(UpdateCharacter, http.MethodPut, "/api/characters/1", body, ""); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("PUT %s: status %d, want 422", body, rec.Code)
+		}
+	}
+	page, err := characterRepo.List(t.Context(), repository.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Items[0].Name != "Hero 1" {
+		t.Errorf("invalid requests changed the store: %+v", page.Items)
+	}
+}
+
+func TestCharacterETagAndIfMatch(t *testing.T) {
+	useFreshRepository(t)
+	createCharacters(t, 1)
+
+	rec := serve(GetCharacterByID, http.MethodGet, "/api/characters/1", "", "")
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET: status %d, ETag %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/characters/1", nil)
+	req.Header.Set("If-None-Match", etag)
+	notModified := httptest.NewRecorder()
+	GetCharacterByID(notModified, req)
+	if notModified.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status %d, want 304", notModified.Code)
+	}
+
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/characters/1",
+			strings.NewReader(`{"name":"Hero 1","role":"healer","game":"Quest"}`))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		UpdateCharacter(rec, req)
+		return rec
+	}
+
+	first := update(etag)
+	if first.Code != http.StatusOK {
+		t.Fatalf("PUT with current ETag: status %d: %s", first.Code, first.Body)
+	}
+	newETag := first.Header().Get("ETag")
+	if newETag == etag {
+		t.Errorf("ETag did not change after update: %q", newETag)
+	}
+
+	stale := update(etag)
+	if stale.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with stale ETag: status %d, want 412", stale.Code)
+	}
+	if got := stale.Header().Get("ETag"); got != newETag {
+		t.Errorf("412 ETag = %q, want current %q", got, newETag)
+	}
+
+	if weak := update("W/" + newETag); weak.Code != http.StatusPreconditionFailed {
+		t.Errorf("If-Match with weak ETag: status %d, want 412", weak.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-rest/models"
+	"go-rest/repository"
+)
+
+// characterETag returns the strong entity tag of a character version
+func characterETag(c models.Character) string {
+	return `"` + strconv.Itoa(c.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match / If-None-Match header lists etag.
+// If-Match uses strong comparison, If-None-Match the weak one (RFC 9110).
+func etagMatches(header, etag string, weak bool) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" {
+			return true
+		}
+		if strings.HasPrefix(t, "W/") {
+			if !weak {
+				continue
+			}
+			t = strings.TrimPrefix(t, "W/")
+		}
+		if t == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeCharacter sends a character together with its ETag
+func writeCharacter(w http.ResponseWriter, status int, c models.Character) {
+	w.Header().Set("ETag", characterETag(c))
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	json.NewEncoder(w).Encode(c)
+}
+
+// checkIfMatch enforces the If-Match precondition against the stored character.
+// It returns the version the write must apply to (0 when the request has no If-Match)
+// and false when a response has already been written.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, id int) (int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	current, err := characterRepo.Get(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "Character not found", http.StatusNotFound)
+			return 0, false
+		}
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return 0, false
+	}
+	if !etagMatches(header, characterETag(current), false) {
+		preconditionFailed(w, current)
+		return 0, false
+	}
+	return current.Version, true
+}
+
+// preconditionFailed answers 412 and tells the client which version is current
+func preconditionFailed(w http.ResponseWriter, current models.Character) {
+	w.Header().Set("ETag", characterETag(current))
+	http.Error(w, "Precondition Failed: character was modified", http.StatusPreconditionFailed)
+}
+
+// writeConflict answers 412 after the repository rejected a versioned write
+func writeConflict(w http.ResponseWriter, r *http.Request, id int) {
+	if current, err := characterRepo.Get(r.Context(), id); err == nil {
+		preconditionFailed(w, current)
+		return
+	}
+	http.Error(w, "Precondition Failed: character was modified", http.StatusPreconditionFailed)
+}
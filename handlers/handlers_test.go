@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+// testPassword is the password of every test user
+const testPassword = "secret123"
+
+// TestMain runs the handler tests against the in-memory repository, without a database
+func TestMain(m *testing.M) {
+	repo := repository.NewMemoryCharacterRepository()
+	SetCharacterRepository(repo)
+	SetAuditRepository(repo)
+	if err := utils.LoadJWTKeys(utils.JWTKeyConfig{Secret: "test-secret"}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	hash, err := utils.HashPassword(testPassword, utils.HashBcrypt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var users []utils.User
+	for _, name := range []string{"admin", "editor", "brute", "reuse", "logout"} {
+		role := utils.RoleEditor
+		if name == "admin" {
+			role = utils.RoleAdmin
+		}
+		users = append(users, utils.User{Username: name, Password: hash, Roles: []string{role}})
+	}
+	if err := utils.ApplyAppConfig(utils.AppConfig{Users: users}, ""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+// serve runs handler on a request with an optional JSON body and bearer token
+func serve(handler http.HandlerFunc, method, target, body, token string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec
+}
+
+// useFreshRepository gives the test an empty in-memory repository
+func useFreshRepository(t *testing.T) {
+	t.Helper()
+	repo := repository.NewMemoryCharacterRepository()
+	SetCharacterRepository(repo)
+	SetAuditRepository(repo)
+}
+
+// login returns the access and refresh token of username
+func login(t *testing.T, username string) tokenResponse {
+	t.Helper()
+	rec := serve(LoginHandler, http.MethodPost, "/api/login",
+		fmt.Sprintf(`{"username":%q,"password":%q}`, username, testPassword), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login %s: status %d: %s", username, rec.Code, rec.Body)
+	}
+	var tokens tokenResponse
+	if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go-rest/config"
+	"go-rest/utils"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// readinessTimeout bounds all readiness checks together, so a hanging database
+// makes the probe fail instead of time out
+const readinessTimeout = 3 * time.Second
+
+// healthPool is pinged by /readyz; nil when running with the in-memory store
+var healthPool *pgxpool.Pool
+
+// SetHealthPool sets the database pool checked by the readiness probe
+func SetHealthPool(pool *pgxpool.Pool) {
+	healthPool = pool
+}
+
+// errSkipped marks checks that do not apply to the current configuration
+var errSkipped = errors.New("skipped")
+
+type healthCheck struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration,omitempty"`
+}
+
+type healthResponse struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks,omitempty"`
+}
+
+// readinessChecks are run in order by /readyz
+var readinessChecks = []struct {
+	name  string
+	check func(ctx context.Context) error
+}{
+	{"database", checkDatabase},
+	{"migrations", checkMigrations},
+	{"jwt_keys", checkJWTKeys},
+	{"users", checkUsers},
+}
+
+func checkDatabase(ctx context.Context) error {
+	if healthPool == nil {
+		return errSkipped
+	}
+	return healthPool.Ping(ctx)
+}
+
+func checkMigrations(ctx context.Context) error {
+	if healthPool == nil {
+		return errSkipped
+	}
+	states, err := config.MigrationStatus(ctx, healthPool)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d pending migrations", pending)
+	}
+	return nil
+}
+
+func checkJWTKeys(ctx context.Context) error {
+	if !utils.JWTKeysLoaded() {
+		return errors.New("signing key not loaded")
+	}
+	return nil
+}
+
+func checkUsers(ctx context.Context) error {
+	if !utils.UsersLoaded() {
+		return errors.New("no users loaded from config.yaml")
+	}
+	return nil
+}
+
+// HealthzHandler is the liveness probe: it answers as long as the process serves HTTP
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeHealth(w, http.StatusOK, healthResponse{Status: "ok"})
+}
+
+// readyzVerbose includes errors and timings, which may reveal internals,
+// so it is only available with the health:read permission
+var readyzVerbose = utils.Secure(utils.Require(utils.PermHealthRead, func(w http.ResponseWriter, r *http.Request) {
+	ready(w, r, true)
+}))
+
+// ReadyzHandler is the readiness probe: it checks the database, migrations,
+// JWT keys and users and answers 503 if any of them fails.
+// ?verbose=1 adds error details and timings for admins.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Query().Has("verbose") {
+		readyzVerbose(w, r)
+		return
+	}
+	ready(w, r, false)
+}
+
+func ready(w http.ResponseWriter, r *http.Request, verbose bool) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	resp := healthResponse{Status: "ok"}
+	for _, c := range readinessChecks {
+		start := time.Now()
+		err := c.check(ctx)
+		result := healthCheck{Name: c.name, Status: "ok"}
+		switch {
+		case errors.Is(err, errSkipped):
+			result.Status = "skipped"
+		case err != nil:
+			result.Status = "fail"
+			resp.Status = "fail"
+			if verbose {
+				result.Error = err.Error()
+			}
+		}
+		if verbose {
+			result.Duration = time.Since(start).String()
+		}
+		resp.Checks = append(resp.Checks, result)
+	}
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeHealth(w, status, resp)
+}
+
+func writeHealth(w http.ResponseWriter, status int, resp healthResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestReadyzWithoutDatabase(t *testing.T) {
+	rec := serve(ReadyzHandler, http.MethodGet, "/readyz", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var resp healthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"database": "skipped", "migrations": "skipped", "jwt_keys": "ok", "users": "ok"}
+	for _, c := range resp.Checks {
+		if want[c.Name] != c.Status {
+			t.Errorf("check %s = %s, want %s", c.Name, c.Status, want[c.Name])
+		}
+	}
+	if rec.Header().Get("Cache-Control") != "no-store" {
+		t.Error("readiness answer may be cached")
+	}
+}
+
+func TestReadyzFailure(t *testing.T) {
+	old := readinessChecks
+	t.Cleanup(func() { readinessChecks = old })
+	const secret = "dial tcp 10.0.0.5:5432: connection refused"
+	readinessChecks = []struct {
+		name  string
+		check func(ctx context.Context) error
+	}{
+		{"database", func(context.Context) error { return errors.New(secret) }},
+		{"jwt_keys", func(context.Context) error { return nil }},
+	}
+	admin, editor := login(t, "admin").Token, login(t, "editor").Token
+
+	tests := []struct {
+		name, target, token string
+		want                int
+		verbose             bool
+	}{
+		{"plain", "/readyz", "", http.StatusServiceUnavailable, false},
+		{"plain with token", "/readyz", admin, http.StatusServiceUnavailable, false},
+		{"verbose without token", "/readyz?verbose=1", "", http.StatusUnauthorized, false},
+		{"verbose without permission", "/readyz?verbose=1", editor, http.StatusForbidden, false},
+		{"verbose as admin", "/readyz?verbose=1", admin, http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(ReadyzHandler, http.MethodGet, tt.target, "", tt.token)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+			if shown := strings.Contains(rec.Body.String(), secret); shown != tt.verbose {
+				t.Errorf("body %q: error shown %v, want %v", rec.Body, shown, tt.verbose)
+			}
+			if tt.want != http.StatusServiceUnavailable {
+				return
+			}
+			var resp healthResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != "fail" || len(resp.Checks) != 2 || resp.Checks[0].Status != "fail" || resp.Checks[1].Status != "ok" {
+				t.Errorf("response = %+v", resp)
+			}
+			for _, c := range resp.Checks {
+				if (c.Duration != "") != tt.verbose {
+					t.Errorf("check %s duration %q with verbose %v", c.Name, c.Duration, tt.verbose)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestJWKSHandler(t *testing.T) {
+	rec := serve(JWKSHandler, http.MethodGet, "/.well-known/jwks.json", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); !strings.Contains(cc, "max-age") {
+		t.Errorf("Cache-Control = %q, want a max-age", cc)
+	}
+	// the handler tests sign with HS256, whose secret must never be published
+	var set map[string][]json.RawMessage
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	if keys, ok := set["keys"]; !ok || keys == nil || len(keys) != 0 {
+		t.Errorf("body = %s, want an empty keys array", rec.Body)
+	}
+
+	if rec := serve(JWKSHandler, http.MethodPost, "/.well-known/jwks.json", "", ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", rec.Code)
+	}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"go-rest/models"
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+// ✅ POST Unlock User
+// @Summary      Buka kunci akun (admin)
+// @Description  Menghapus lockout dan hitungan login gagal sebuah username, dan juga sebuah IP client jika parameter ip diisi
+// @Tags         users
+// @Param        username  path   string  true   "Username"
+// @Param        ip        query  string  false  "IP client yang ikut dibuka kuncinya"
+// @Success      204  "No Content"
+// @Failure      400  {object}  map[string]string
+// @Failure      403  {object}  map[string]string
+// @Router       /users/{username}/unlock [post]
+// @Security     BearerAuth
+func UnlockUser(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/users/")
+	username, action, ok := strings.Cut(rest, "/")
+	if !ok || action != "unlock" || username == "" {
+		ApiNotFoundHandler(w, r)
+		return
+	}
+	changes := map[string]models.FieldChange{}
+	if raw := r.URL.Query().Get("ip"); raw != "" {
+		ip := net.ParseIP(raw)
+		if ip == nil {
+			http.Error(w, "Invalid IP", http.StatusBadRequest)
+			return
+		}
+		if utils.UnlockIP(ip.String()) {
+			changes["ip"] = models.FieldChange{To: ip.String()}
+		}
+	}
+	if utils.UnlockUser(username) || len(changes) > 0 {
+		recordAudit(r, repository.EntityUser, username, repository.ActionUnlock, utils.Subject(r), changes)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+func TestUnlockUserAndIP(t *testing.T) {
+	repo := repository.NewMemoryCharacterRepository()
+	SetCharacterRepository(repo)
+	SetAuditRepository(repo)
+	admin := login(t, "admin").Token
+	utils.SetLoginPolicy(utils.LoginPolicy{FreeAttempts: 10, MaxAttempts: 2, MaxAttemptsPerIP: 3})
+	// earlier login tests share the test client IP
+	utils.UnlockIP("192.0.2.1")
+	t.Cleanup(func() {
+		utils.SetLoginPolicy(utils.DefaultLoginPolicy)
+		utils.UnlockIP("192.0.2.1")
+		utils.UnlockUser("ghost")
+	})
+	unlock := utils.Secure(UnlockUser)
+	attempt := func(username, password string) int {
+		return serve(LoginHandler, http.MethodPost, "/api/login", `{"username":"`+username+`","password":"`+password+`"}`, "").Code
+	}
+
+	// failures for different usernames lock only the IP (httptest requests come from 192.0.2.1)
+	for _, name := range []string{"ghost1", "ghost2", "ghost3"} {
+		attempt(name, "wrong")
+	}
+	if got := attempt("admin", testPassword); got != http.StatusTooManyRequests {
+		t.Fatalf("login from locked IP: status %d, want 429", got)
+	}
+	if rec := serve(unlock, http.MethodPost, "/api/users/ghost1/unlock?ip=not-an-ip", "", admin); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid ip: status %d, want 400", rec.Code)
+	}
+	if rec := serve(unlock, http.MethodPost, "/api/users/ghost1/unlock", "", admin); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlock user: status %d", rec.Code)
+	}
+	if got := attempt("admin", testPassword); got != http.StatusTooManyRequests {
+		t.Errorf("unlocking the user lifted the IP lockout: status %d", got)
+	}
+	if rec := serve(unlock, http.MethodPost, "/api/users/ghost1/unlock?ip=192.0.2.1", "", admin); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlock user and ip: status %d", rec.Code)
+	}
+	if got := attempt("admin", testPassword); got != http.StatusOK {
+		t.Errorf("login after IP unlock: status %d, want 200", got)
+	}
+
+	// a locked username is unlocked without touching the IP
+	attempt("ghost", "wrong")
+	attempt("ghost", "wrong")
+	if got := attempt("ghost", "wrong"); got != http.StatusTooManyRequests {
+		t.Fatalf("locked user: status %d, want 429", got)
+	}
+	if rec := serve(unlock, http.MethodPost, "/api/users/ghost/unlock", "", admin); rec.Code != http.StatusNoContent {
+		t.Fatalf("unlock ghost: status %d", rec.Code)
+	}
+	if got := attempt("ghost", "wrong"); got != http.StatusUnauthorized {
+		t.Errorf("login after user unlock: status %d, want 401", got)
+	}
+
+	entries, err := repo.ListAudit(context.Background(), repository.AuditFilter{Action: repository.ActionUnlock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d unlock entries, want 3: %+v", len(entries), entries)
+	}
+	if ip := entries[1].Changes["ip"]; ip.To != "192.0.2.1" || entries[1].Actor != "admin" {
+		t.Errorf("IP unlock entry = %+v", entries[1])
+	}
+}
@@ -1,18 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"go-rest/config"
 	"go-rest/handlers"
+	"go-rest/repository"
 	"go-rest/utils"
-	
 
 	httpSwagger "github.com/swaggo/http-swagger"
 	_ "go-rest/docs" // hasil generate swag
 )
 
+// handle registers h for pattern, with request metrics labelled by the pattern
+func handle(pattern string, h http.HandlerFunc) {
+	http.HandleFunc(pattern, utils.Instrumented(pattern, h))
+}
+
 func setupRoutes() {
 	// 🔹 Swagger docs
 	http.Handle("/swagger/", httpSwagger.WrapHandler)
@@ -20,43 +31,108 @@ func setupRoutes() {
 	// 🔹 Serve static files (CSS, JS, gambar, dll)
 	http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("frontend/static"))))
 	// Serve HTML
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	handle("/", func(w http.ResponseWriter, r *http.Request) {
 		http.ServeFile(w, r, "frontend/index.html")
 	})
+	// 🔹 Liveness & readiness probes
+	handle("/healthz", handlers.HealthzHandler)
+	handle("/readyz", handlers.ReadyzHandler)
+
+	// 🔹 Prometheus metrics
+	http.Handle("/metrics", utils.MetricsHandler())
+
 	// 🔹 Auth endpoints
-	http.HandleFunc("/api/login", handlers.LoginHandler)
-	http.HandleFunc("/api/logout", utils.Secure(handlers.LogoutHandler))
-	http.HandleFunc("/api/refresh", handlers.RefreshHandler)
+	handle("/api/login", utils.RateLimited("/api/login", handlers.LoginHandler))
+	handle("/api/logout", utils.Secure(utils.RateLimited("/api/logout", handlers.LogoutHandler)))
+	handle("/api/refresh", utils.RateLimited("/api/refresh", handlers.RefreshHandler))
+	handle("/.well-known/jwks.json", handlers.JWKSHandler)
 
-	// 🔹 Characters CRUD (secured)
+	// 🔹 Characters CRUD (secured, permission per method)
 	// GET all & POST
-	http.HandleFunc("/api/characters", utils.Secure(func(w http.ResponseWriter, r *http.Request) {
-		switch r.Method {
-		case http.MethodGet:
-			handlers.GetCharacters(w, r)
-		case http.MethodPost:
+	handle("/api/characters", utils.Secure(utils.RateLimited("/api/characters", utils.Authorize(utils.MethodPermissions{
+		http.MethodGet:  utils.PermCharactersRead,
+		http.MethodPost: utils.PermCharactersWrite,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
 			handlers.CreateCharacter(w, r)
-		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
-	}))
+		handlers.GetCharacters(w, r)
+	}))))
+
+	// Full-text & fuzzy search
+	handle("/api/characters/search", utils.Secure(utils.RateLimited("/api/characters/search", utils.Authorize(utils.MethodPermissions{
+		http.MethodGet: utils.PermCharactersRead,
+	}, handlers.SearchCharacters))))
+
+	// Trash: soft deleted characters
+	handle("/api/characters/trash", utils.Secure(utils.RateLimited("/api/characters/trash", utils.Authorize(utils.MethodPermissions{
+		http.MethodGet: utils.PermCharactersRead,
+	}, handlers.GetDeletedCharacters))))
 
-	// GET by ID, PUT, DELETE
-	http.HandleFunc("/api/characters/", utils.Secure(func(w http.ResponseWriter, r *http.Request) {
+	// GET by ID, PUT, PATCH, DELETE, restore, history & purge
+	characterItem := utils.Authorize(utils.MethodPermissions{
+		http.MethodGet:    utils.PermCharactersRead,
+		http.MethodPut:    utils.PermCharactersWrite,
+		http.MethodPatch:  utils.PermCharactersWrite,
+		http.MethodDelete: utils.PermCharactersDelete,
+	}, func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			handlers.GetCharacterByID(w, r)
 		case http.MethodPut:
 			handlers.UpdateCharacter(w, r)
+		case http.MethodPatch:
+			handlers.PatchCharacter(w, r)
 		case http.MethodDelete:
 			handlers.DeleteCharacter(w, r)
+		}
+	})
+	restore := utils.Authorize(utils.MethodPermissions{http.MethodPost: utils.PermCharactersWrite}, handlers.RestoreCharacter)
+	history := utils.Authorize(utils.MethodPermissions{http.MethodGet: utils.PermCharactersRead}, handlers.GetCharacterHistory)
+	purge := utils.Authorize(utils.MethodPermissions{http.MethodDelete: utils.PermCharactersPurge}, handlers.PurgeCharacter)
+	handle("/api/characters/", utils.Secure(utils.RateLimited("/api/characters/", func(w http.ResponseWriter, r *http.Request) {
+		switch handlers.CharacterAction(r) {
+		case "":
+			characterItem(w, r)
+		case "restore":
+			restore(w, r)
+		case "history":
+			history(w, r)
+		case "purge":
+			purge(w, r)
 		default:
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			handlers.ApiNotFoundHandler(w, r)
 		}
-	}))
+	})))
+
+	// 🔹 Audit trail
+	handle("/api/audit", utils.Secure(utils.RateLimited("/api/audit", utils.Authorize(utils.MethodPermissions{
+		http.MethodGet: utils.PermAuditRead,
+	}, handlers.GetAuditLog))))
+
+	// 🔹 API keys for service accounts
+	handle("/api/apikeys", utils.Secure(utils.RateLimited("/api/apikeys", utils.Authorize(utils.MethodPermissions{
+		http.MethodGet:  utils.PermAPIKeysManage,
+		http.MethodPost: utils.PermAPIKeysManage,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			handlers.CreateAPIKey(w, r)
+			return
+		}
+		handlers.GetAPIKeys(w, r)
+	}))))
+	handle("/api/apikeys/", utils.Secure(utils.RateLimited("/api/apikeys/", utils.Authorize(utils.MethodPermissions{
+		http.MethodDelete: utils.PermAPIKeysManage,
+	}, handlers.RevokeAPIKey))))
+
+	// 🔹 Unlock accounts locked by failed logins
+	handle("/api/users/", utils.Secure(utils.RateLimited("/api/users/", utils.Authorize(utils.MethodPermissions{
+		http.MethodPost: utils.PermUsersManage,
+	}, handlers.UnlockUser))))
 
 	// 🔹 API not found fallback
-	http.HandleFunc("/api/", handlers.ApiNotFoundHandler)
+	handle("/api/", handlers.ApiNotFoundHandler)
 }
 
 // @title           Game Characters REST API
@@ -79,26 +155,123 @@ func setupRoutes() {
 // @name Authorization
 
 func main() {
-	pool, err := config.InitDB()
+	fs := config.NewFlagSet(os.Stderr)
+	fs.Usage = func() { printUsage(fs) }
+	cfg, args, err := config.Load(fs, os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		fmt.Println("❌ Gagal konek ke database:", err)
-		return
+		fmt.Fprintln(os.Stderr, "❌ Konfigurasi tidak valid:", err)
+		os.Exit(2)
 	}
-	defer pool.Close()
 
-	if err := config.RunMigration(pool); err != nil {
-		fmt.Println("❌ Gagal menjalankan migration:", err)
-		return
+	if err := utils.SetupLogger(os.Stderr, cfg.Log); err != nil {
+		fmt.Fprintln(os.Stderr, "❌ Konfigurasi log tidak valid:", err)
+		os.Exit(1)
+	}
+	shutdownTracing, err := utils.SetupTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("gagal menyiapkan tracing", "error", err)
+		os.Exit(1)
+	}
+
+	code := 0
+	if len(args) > 0 {
+		code = runCommand(cfg, args)
+	} else if err := run(cfg); err != nil {
+		slog.Error("server berhenti karena error", "error", err)
+		code = 1
 	}
+	// os.Exit skips deferred calls, so flush the remaining spans first
+	shutdownTracing(context.Background())
+	os.Exit(code)
+}
+
+// run starts the server with cfg and blocks until it is shut down. Resources are
+// released by its deferred calls before it returns, also on error.
+func run(cfg config.Config) error {
+	switch cfg.Database.Store {
+	case "memory":
+		slog.Warn("menggunakan penyimpanan in-memory, data hilang saat server berhenti")
+		repo := repository.NewMemoryCharacterRepository()
+		handlers.SetCharacterRepository(repo)
+		handlers.SetAuditRepository(repo)
+	case "postgres":
+		pool, err := config.InitDB(cfg.Database)
+		if err != nil {
+			return fmt.Errorf("gagal konek ke database: %w", err)
+		}
+		// closed last, after the server has drained and the sweepers have stopped
+		defer pool.Close()
 
-	if err := utils.LoadUsersFromYAML("config.yaml"); err != nil {
-		fmt.Println("⚠️ Gagal baca config.yaml:", err)
+		if err := config.MigrateUp(context.Background(), pool); err != nil {
+			return fmt.Errorf("gagal menjalankan migration: %w", err)
+		}
+		repo := repository.NewPostgresCharacterRepository(pool)
+		handlers.SetCharacterRepository(repo)
+		handlers.SetAuditRepository(repo)
+		handlers.SetHealthPool(pool)
+		utils.SetRefreshStore(utils.NewPostgresRefreshStore(pool))
+		utils.SetRevocationStore(utils.NewPostgresRevocationStore(pool))
+		utils.SetAPIKeyStore(utils.NewPostgresAPIKeyStore(pool))
+		utils.SetRateLimitStore(utils.NewPostgresRateLimitStore(pool))
+		if err := utils.RegisterPoolMetrics(pool); err != nil {
+			slog.Warn("gagal mendaftarkan metrics pool", "error", err)
+		}
+	}
+
+	if err := utils.LoadJWTKeys(cfg.Auth.JWTKeyConfig); err != nil {
+		return fmt.Errorf("gagal memuat JWT key: %w", err)
+	}
+	if cfg.Auth.SigningKey == "" && cfg.Auth.Secret == "" {
+		slog.Warn("auth.jwt_secret / JWT_SECRET tidak di-set, token ditandatangani dengan secret development")
+	}
+	utils.SetTokenTTLs(cfg.Auth.AccessTokenTTL, cfg.Auth.RefreshTokenTTL)
+	if err := utils.ApplyAppConfig(cfg.AppConfig, cfg.File); err != nil {
+		return fmt.Errorf("gagal menerapkan konfigurasi user: %w", err)
+	}
+	if !utils.UsersLoaded() {
+		slog.Warn("tidak ada user di konfigurasi, login tidak bisa dipakai", "file", cfg.File)
 	}
 
 	setupRoutes()
 
-	fmt.Println("🚀 Server running at http://localhost:8080")
-	if err := http.ListenAndServe(":8080", nil); err != nil {
-		fmt.Println("❌ Server error:", err)
+	// tracing continues an incoming traceparent, request IDs and access log wrap
+	// everything below it, Recover turns panics into logged 500s
+	handler := utils.Traced(utils.RequestLogger(utils.Recover(http.DefaultServeMux)))
+
+	srv := newServer(handler, cfg.Server)
+	slog.Info("server running", "addr", cfg.Server.Addr)
+	// shutdown order: server drained, then sweepers and watcher, then the deferred pool close
+	err := serve(srv, cfg.Server.ShutdownTimeout,
+		// remove expired revoked JTIs, refresh tokens and idle rate limit buckets in the background
+		func(ctx context.Context) { utils.RunSweeper(ctx, time.Minute) },
+		// reload users, roles, login policy and rate limits when the file changes or on SIGHUP
+		func(ctx context.Context) {
+			config.Watch(ctx, cfg.File, func(ctx context.Context) { reloadAppConfig(ctx, cfg.File) })
+		})
+	if err != nil {
+		return err
+	}
+	slog.Info("server berhenti")
+	return nil
+}
+
+// reloadAppConfig swaps in the users, roles, login policy and rate limits of the
+// config file; an invalid file is logged and the running config is kept
+func reloadAppConfig(ctx context.Context, path string) {
+	app, err := config.ReadAppConfig(path)
+	if err == nil {
+		err = utils.ReloadAppConfig(ctx, app, path)
+	}
+	if errors.Is(err, utils.ErrTokenRevocation) {
+		slog.Error("config di-reload, tetapi pencabutan token gagal", "file", path, "users", len(app.Users), "error", err)
+		return
+	}
+	if err != nil {
+		slog.Error("reload config gagal, konfigurasi lama tetap dipakai", "file", path, "error", err)
+		return
 	}
+	slog.Info("config di-reload", "file", path, "users", len(app.Users))
 }
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go-rest/handlers"
+	"go-rest/models"
+	"go-rest/repository"
+	"go-rest/utils"
+)
+
+// testPassword is the password of every test user
+const testPassword = "secret123"
+
+// testRepo is the in-memory repository behind the routes
+var testRepo = repository.NewMemoryCharacterRepository()
+
+// TestMain serves the real routes against the in-memory repository, with one user per role
+func TestMain(m *testing.M) {
+	handlers.SetCharacterRepository(testRepo)
+	handlers.SetAuditRepository(testRepo)
+	if err := utils.LoadJWTKeys(utils.JWTKeyConfig{Secret: "test-secret"}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	hash, err := utils.HashPassword(testPassword, utils.HashBcrypt)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var users []utils.User
+	for _, role := range []string{utils.RoleAdmin, utils.RoleEditor, utils.RoleViewer} {
+		users = append(users, utils.User{Username: role, Password: hash, Roles: []string{role}})
+	}
+	if err := utils.ApplyAppConfig(utils.AppConfig{Users: users}, ""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	setupRoutes()
+	os.Exit(m.Run())
+}
+
+// tokens caches one access token per test user, so the login rate limit is not hit
+var tokens = map[string]string{}
+
+// request sends a JSON request through the registered routes, as username unless it is empty
+func request(t *testing.T, method, target, body, username string) *httptest.ResponseRecorder {
+	t.Helper()
+	return requestWith(t, method, target, "application/json", body, username)
+}
+
+// requestWith is request with another media type for the body
+func requestWith(t *testing.T, method, target, mediaType, body, username string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set("Content-Type", mediaType)
+	}
+	if username != "" {
+		req.Header.Set("Authorization", "Bearer "+token(t, username))
+	}
+	rec := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, req)
+	return rec
+}
+
+// token logs username in once and returns its access token
+func token(t *testing.T, username string) string {
+	t.Helper()
+	if tok, ok := tokens[username]; ok {
+		return tok
+	}
+	rec := request(t, http.MethodPost, "/api/login",
+		fmt.Sprintf(`{"username":%q,"password":%q}`, username, testPassword), "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("login %s: status %d: %s", username, rec.Code, rec.Body)
+	}
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	tokens[username] = resp.Token
+	return resp.Token
+}
+
+// createCharacter stores a character through the API and returns it
+func createCharacter(t *testing.T, name string) models.Character {
+	t.Helper()
+	rec := request(t, http.MethodPost, "/api/characters",
+		fmt.Sprintf(`{"name":%q,"role":"mage","game":"Test"}`, name), utils.RoleEditor)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create %s: status %d: %s", name, rec.Code, rec.Body)
+	}
+	var c models.Character
+	if err := json.NewDecoder(rec.Body).Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// containsCharacter reports whether the JSON array in rec holds a character with id
+func containsCharacter(t *testing.T, rec *httptest.ResponseRecorder, id int) bool {
+	t.Helper()
+	var characters []models.Character
+	if err := json.Unmarshal(rec.Body.Bytes(), &characters); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	for _, c := range characters {
+		if c.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTrashRestoreAndPurge(t *testing.T) {
+	c := createCharacter(t, "Trashed")
+	item := fmt.Sprintf("/api/characters/%d", c.ID)
+
+	if rec := request(t, http.MethodDelete, item, "", utils.RoleAdmin); rec.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, http.MethodGet, item, "", utils.RoleViewer); rec.Code != http.StatusNotFound {
+		t.Errorf("get deleted: status %d, want 404", rec.Code)
+	}
+	if rec := request(t, http.MethodGet, "/api/characters", "", utils.RoleViewer); containsCharacter(t, rec, c.ID) {
+		t.Error("deleted character is still listed")
+	}
+	if rec := request(t, http.MethodGet, "/api/characters/trash", "", utils.RoleViewer); !containsCharacter(t, rec, c.ID) {
+		t.Error("deleted character is missing from the trash")
+	}
+
+	if rec := request(t, http.MethodPost, item+"/restore", "", utils.RoleEditor); rec.Code != http.StatusOK {
+		t.Fatalf("restore: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, http.MethodGet, item, "", utils.RoleViewer); rec.Code != http.StatusOK {
+		t.Errorf("get restored: status %d, want 200", rec.Code)
+	}
+	if rec := request(t, http.MethodGet, "/api/characters/trash", "", utils.RoleViewer); containsCharacter(t, rec, c.ID) {
+		t.Error("restored character is still in the trash")
+	}
+
+	// purge is admin only and removes the row for good
+	if rec := request(t, http.MethodDelete, item+"/purge", "", utils.RoleEditor); rec.Code != http.StatusForbidden {
+		t.Errorf("purge as editor: status %d, want 403", rec.Code)
+	}
+	if rec := request(t, http.MethodDelete, item+"/purge", "", utils.RoleAdmin); rec.Code != http.StatusNoContent {
+		t.Fatalf("purge as admin: status %d: %s", rec.Code, rec.Body)
+	}
+	if rec := request(t, http.MethodGet, item, "", utils.RoleViewer); rec.Code != http.StatusNotFound {
+		t.Errorf("get purged: status %d, want 404", rec.Code)
+	}
+	if rec := request(t, http.MethodPost, item+"/restore", "", utils.RoleEditor); rec.Code != http.StatusNotFound {
+		t.Errorf("restore purged: status %d, want 404", rec.Code)
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	ctx := t.Context()
+	// each fixture returns a fresh target, so a route that consumes it can be called once per role
+	character := func(t *testing.T) string {
+		c := &models.Character{Name: "Matrix", Role: "mage", Game: "Test"}
+		if err := testRepo.Create(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("/api/characters/%d", c.ID)
+	}
+	deletedCharacter := func(t *testing.T) string {
+		target := character(t)
+		id, _ := strconv.Atoi(path.Base(target))
+		if err := testRepo.Delete(ctx, id, 0); err != nil {
+			t.Fatal(err)
+		}
+		return target
+	}
+	apiKey := func(t *testing.T) string {
+		_, k, err := utils.CreateAPIKey(ctx, "matrix", []string{utils.PermCharactersRead}, nil, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return "/api/apikeys/" + k.ID
+	}
+	fixed := func(target string) func(*testing.T) string {
+		return func(*testing.T) string { return target }
+	}
+
+	// the default roles: viewers read, editors also write, admins do everything
+	everyone := []string{utils.RoleViewer, utils.RoleEditor, utils.RoleAdmin}
+	writers := []string{utils.RoleEditor, utils.RoleAdmin}
+	admins := []string{utils.RoleAdmin}
+
+	routes := []struct {
+		method string
+		target func(*testing.T) string
+		suffix string
+		media  string
+		body   string
+		roles  []string
+	}{
+		{http.MethodGet, fixed("/api/characters"), "", "", "", everyone},
+		{http.MethodPost, fixed("/api/characters"), "", "", `{"name":"Matrix","role":"mage","game":"Test"}`, writers},
+		{http.MethodGet, fixed("/api/characters/search?q=matrix"), "", "", "", everyone},
+		{http.MethodGet, fixed("/api/characters/trash"), "", "", "", everyone},
+		{http.MethodGet, character, "", "", "", everyone},
+		{http.MethodPut, character, "", "", `{"name":"Matrix","role":"healer","game":"Test"}`, writers},
+		{http.MethodPatch, character, "", "application/merge-patch+json", `{"role":"healer"}`, writers},
+		{http.MethodDelete, character, "", "", "", admins},
+		{http.MethodGet, character, "/history", "", "", everyone},
+		{http.MethodPost, deletedCharacter, "/restore", "", "", writers},
+		{http.MethodDelete, character, "/purge", "", "", admins},
+		{http.MethodGet, fixed("/api/audit"), "", "", "", admins},
+		{http.MethodGet, fixed("/api/apikeys"), "", "", "", admins},
+		{http.MethodPost, fixed("/api/apikeys"), "", "", `{"name":"matrix","scopes":["characters:read"]}`, admins},
+		{http.MethodDelete, apiKey, "", "", "", admins},
+		{http.MethodPost, fixed("/api/users/viewer/unlock"), "", "", "", admins},
+		{http.MethodGet, fixed("/readyz?verbose=1"), "", "", "", admins},
+	}
+	for _, route := range routes {
+		for _, role := range []string{utils.RoleViewer, utils.RoleEditor, utils.RoleAdmin} {
+			target := route.target(t) + route.suffix
+			media := route.media
+			if media == "" {
+				media = "application/json"
+			}
+			rec := requestWith(t, route.method, target, media, route.body, role)
+			allowed := slices.Contains(route.roles, role)
+			switch {
+			case allowed && (rec.Code < 200 || rec.Code > 299):
+				t.Errorf("%s %s as %s: status %d, want 2xx: %s", route.method, target, role, rec.Code, rec.Body)
+			case !allowed && rec.Code != http.StatusForbidden:
+				t.Errorf("%s %s as %s: status %d, want 403", route.method, target, role, rec.Code)
+			}
+		}
+		target := route.target(t) + route.suffix
+		if rec := request(t, route.method, target, route.body, ""); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s without token: status %d, want 401", route.method, target, rec.Code)
+		}
+	}
+}
+
+func TestMetricsAreLabelledByRoutePattern(t *testing.T) {
+	for _, target := range []string{"/api/characters/900001", "/api/characters/900002/history", "/api/nothing/900003"} {
+		request(t, http.MethodGet, target, "", utils.RoleViewer)
+	}
+	rec := request(t, http.MethodGet, "/metrics", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("metrics: status %d", rec.Code)
+	}
+	metrics := rec.Body.String()
+	for _, series := range []string{
+		`http_requests_total{method="GET",route="/api/characters/",status="404"}`,
+		`http_requests_total{method="GET",route="/api/",status="404"}`,
+		`http_requests_total{method="GET",route="/api/characters/",status="200"}`,
+		`http_request_duration_seconds_count{method="GET",route="/api/characters/",status="404"}`,
+	} {
+		if !strings.Contains(metrics, series) {
+			t.Errorf("metrics lack %s", series)
+		}
+	}
+	for _, id := range []string{"900001", "900002", "900003"} {
+		if strings.Contains(metrics, id) {
+			t.Errorf("request path with %s leaked into a metric label", id)
+		}
+	}
+}
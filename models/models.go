@@ -8,7 +8,32 @@ type Character struct {
 	Name      string     `json:"name"`
 	Role      string     `json:"role"`
 	Game      string     `json:"game"`
+	Version   int        `json:"version"`
 	CreatedAt time.Time  `json:"created_at"`
 	UpdatedAt time.Time  `json:"updated_at"`
 	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
+
+// Hasil pencarian karakter beserta skor relevansi dan highlight per field
+type CharacterSearchResult struct {
+	Character
+	Score      float64           `json:"score"`
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// Satu baris audit trail: siapa melakukan apa terhadap entity mana, beserta diff field
+type AuditEntry struct {
+	ID        int64                  `json:"id"`
+	Entity    string                 `json:"entity"`
+	EntityID  string                 `json:"entity_id"`
+	Action    string                 `json:"action"`
+	Actor     string                 `json:"actor"`
+	Changes   map[string]FieldChange `json:"changes,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+}
+
+// Nilai sebelum dan sesudah perubahan sebuah field
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go-rest/models"
+)
+
+// Audit actions recorded for character mutations, API keys and logins
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionDelete  = "delete"
+	ActionRestore = "restore"
+	ActionPurge   = "purge"
+	ActionRevoke  = "revoke"
+
+	ActionLoginFailed = "login_failed"
+	ActionLockout     = "lockout"
+	ActionUnlock      = "unlock"
+)
+
+// Audit entity names
+const (
+	EntityCharacter = "character"
+	EntityAPIKey    = "api_key"
+	EntityUser      = "user"
+)
+
+// AuditRepository stores and queries the audit trail
+type AuditRepository interface {
+	// RecordAudit appends an entry that is not tied to a character mutation
+	RecordAudit(ctx context.Context, entry models.AuditEntry) error
+	// ListAudit returns entries matching the filter, newest first
+	ListAudit(ctx context.Context, filter AuditFilter) ([]models.AuditEntry, error)
+}
+
+// AuditFilter narrows down ListAudit; zero values mean "any"
+type AuditFilter struct {
+	Entity   string
+	EntityID string
+	Actor    string
+	Action   string
+	Since    time.Time
+	Until    time.Time
+	Limit    int
+	Offset   int
+}
+
+type actorKey struct{}
+
+// WithActor attaches the user performing a mutation, recorded in the audit trail
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// actorFrom returns the actor set by WithActor, or "system"
+func actorFrom(ctx context.Context) string {
+	if actor, _ := ctx.Value(actorKey{}).(string); actor != "" {
+		return actor
+	}
+	return "system"
+}
+
+// characterAudit builds the audit entry of a character mutation; before or after may be nil
+func characterAudit(ctx context.Context, action string, before, after *models.Character) models.AuditEntry {
+	id := 0
+	if before != nil {
+		id = before.ID
+	} else if after != nil {
+		id = after.ID
+	}
+	return models.AuditEntry{
+		Entity:    EntityCharacter,
+		EntityID:  strconv.Itoa(id),
+		Action:    action,
+		Actor:     actorFrom(ctx),
+		Changes:   diffCharacters(before, after),
+		CreatedAt: time.Now(),
+	}
+}
+
+// diffCharacters lists the user-visible fields that differ between two versions
+func diffCharacters(before, after *models.Character) map[string]models.FieldChange {
+	fields := func(c *models.Character) map[string]any {
+		if c == nil {
+			return map[string]any{"name": nil, "role": nil, "game": nil, "deleted_at": nil}
+		}
+		var deletedAt any
+		if c.DeletedAt != nil {
+			deletedAt = c.DeletedAt.UTC().Format(time.RFC3339Nano)
+		}
+		return map[string]any{"name": c.Name, "role": c.Role, "game": c.Game, "deleted_at": deletedAt}
+	}
+
+	from, to := fields(before), fields(after)
+	changes := map[string]models.FieldChange{}
+	for k := range from {
+		if from[k] != to[k] {
+			changes[k] = models.FieldChange{From: from[k], To: to[k]}
+		}
+	}
+	return changes
+}
+
+// normalizeAuditFilter applies the same page size rules as List
+func normalizeAuditFilter(f *AuditFilter) {
+	if f.Limit <= 0 {
+		f.Limit = DefaultLimit
+	}
+	if f.Limit > MaxLimit {
+		f.Limit = MaxLimit
+	}
+	if f.Offset < 0 {
+		f.Offset = 0
+	}
+}
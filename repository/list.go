@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"go-rest/models"
+)
+
+const (
+	// DefaultLimit is used when the client does not ask for a page size
+	DefaultLimit = 50
+	// MaxLimit caps the page size a client may request
+	MaxLimit = 500
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded or does not match the requested sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortColumns lists the columns List can sort by
+var SortColumns = map[string]bool{
+	"id":         true,
+	"name":       true,
+	"role":       true,
+	"game":       true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// ListOptions controls filtering, sorting and pagination of List
+type ListOptions struct {
+	Role          string
+	Game          string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	Sort string
+	Desc bool
+
+	Limit  int
+	Offset int
+	Cursor *Cursor
+}
+
+// Page is one page of List results
+type Page struct {
+	Items      []models.Character
+	Total      int
+	NextCursor string
+}
+
+// Cursor marks the last row of a page for keyset pagination
+type Cursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// Normalize fills in defaults and rejects unknown sort columns
+func (o *ListOptions) Normalize() error {
+	if o.Sort == "" {
+		o.Sort = "id"
+	}
+	if !SortColumns[o.Sort] {
+		return errors.New("invalid sort column: " + o.Sort)
+	}
+	if o.Limit <= 0 {
+		o.Limit = DefaultLimit
+	}
+	if o.Limit > MaxLimit {
+		o.Limit = MaxLimit
+	}
+	if o.Offset < 0 {
+		o.Offset = 0
+	}
+	if o.Cursor != nil && (o.Cursor.Sort != o.Sort || o.Cursor.Desc != o.Desc) {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// EncodeCursor serializes a cursor into an opaque URL-safe string
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by EncodeCursor and checks its sort value
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || !SortColumns[c.Sort] {
+		return nil, ErrInvalidCursor
+	}
+	// timestamps are cast by PostgreSQL, so a bad value must not get that far
+	if c.Sort == "created_at" || c.Sort == "updated_at" {
+		if _, err := time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &c, nil
+}
+
+// cursorFor builds the cursor pointing after c for the given sort
+func cursorFor(c models.Character, opts ListOptions) string {
+	return EncodeCursor(Cursor{Sort: opts.Sort, Desc: opts.Desc, Value: sortValue(c, opts.Sort), ID: c.ID})
+}
+
+// sortValue renders the sort column of c the same way PostgreSQL parses it back
+func sortValue(c models.Character, column string) string {
+	switch column {
+	case "name":
+		return c.Name
+	case "role":
+		return c.Role
+	case "game":
+		return c.Game
+	case "created_at":
+		return c.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "updated_at":
+		return c.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		return strconv.Itoa(c.ID)
+	}
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeCursor(t *testing.T) {
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	tests := []struct {
+		name    string
+		cursor  string
+		wantErr bool
+	}{
+		{"round trip", EncodeCursor(Cursor{Sort: "name", Value: "Arthas", ID: 3}), false},
+		{"timestamp", EncodeCursor(Cursor{Sort: "created_at", Value: now, ID: 3}), false},
+		{"not base64", "%%%", true},
+		{"not JSON", base64.RawURLEncoding.EncodeToString([]byte("nope")), true},
+		{"unknown sort", EncodeCursor(Cursor{Sort: "deleted_at", Value: now, ID: 3}), true},
+		{"bad created_at", EncodeCursor(Cursor{Sort: "created_at", Value: "2024-13-45", ID: 3}), true},
+		{"bad updated_at", EncodeCursor(Cursor{Sort: "updated_at", Value: "now()", ID: 3}), true},
+		{"empty timestamp", EncodeCursor(Cursor{Sort: "updated_at", ID: 3}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := DecodeCursor(tt.cursor)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Errorf("err = %v, want ErrInvalidCursor", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.ID != 3 {
+				t.Errorf("ID = %d, want 3", c.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-rest/models"
+)
+
+// MemoryCharacterRepository keeps characters and their audit trail in memory, for development and tests
+type MemoryCharacterRepository struct {
+	mu     sync.RWMutex
+	data   map[int]models.Character
+	lastID int
+	audit  []models.AuditEntry
+}
+
+// NewMemoryCharacterRepository creates an empty in-memory repository
+func NewMemoryCharacterRepository() *MemoryCharacterRepository {
+	return &MemoryCharacterRepository{data: make(map[int]models.Character)}
+}
+
+func (m *MemoryCharacterRepository) List(ctx context.Context, opts ListOptions) (Page, error) {
+	if err := opts.Normalize(); err != nil {
+		return Page{}, err
+	}
+
+	characters := m.filter(func(c models.Character) bool {
+		switch {
+		case c.DeletedAt != nil:
+			return false
+		case opts.Role != "" && !strings.EqualFold(c.Role, opts.Role):
+			return false
+		case opts.Game != "" && !strings.EqualFold(c.Game, opts.Game):
+			return false
+		case !opts.CreatedAfter.IsZero() && c.CreatedAt.Before(opts.CreatedAfter):
+			return false
+		case !opts.CreatedBefore.IsZero() && !c.CreatedAt.Before(opts.CreatedBefore):
+			return false
+		}
+		return true
+	})
+	page := Page{Total: len(characters)}
+
+	less := func(a, b models.Character) bool {
+		if cmp := compareColumn(a, b, opts.Sort); cmp != 0 {
+			return (cmp < 0) != opts.Desc
+		}
+		if a.ID == b.ID {
+			return false
+		}
+		return (a.ID < b.ID) != opts.Desc
+	}
+	sort.Slice(characters, func(i, j int) bool { return less(characters[i], characters[j]) })
+
+	if c := opts.Cursor; c != nil {
+		after, err := cursorCharacter(*c)
+		if err != nil {
+			return Page{}, err
+		}
+		start := sort.Search(len(characters), func(i int) bool { return less(after, characters[i]) })
+		characters = characters[start:]
+	}
+	if opts.Offset >= len(characters) {
+		characters = nil
+	} else {
+		characters = characters[opts.Offset:]
+	}
+	if len(characters) > opts.Limit {
+		characters = characters[:opts.Limit]
+		page.NextCursor = cursorFor(characters[len(characters)-1], opts)
+	}
+	page.Items = append([]models.Character{}, characters...)
+	return page, nil
+}
+
+// compareColumn orders two characters by a single sort column
+func compareColumn(a, b models.Character, column string) int {
+	switch column {
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "role":
+		return strings.Compare(a.Role, b.Role)
+	case "game":
+		return strings.Compare(a.Game, b.Game)
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	return 0
+}
+
+// cursorCharacter turns a cursor back into a character that sorts at the cursor position
+func cursorCharacter(c Cursor) (models.Character, error) {
+	ch := models.Character{ID: c.ID}
+	switch c.Sort {
+	case "name":
+		ch.Name = c.Value
+	case "role":
+		ch.Role = c.Value
+	case "game":
+		ch.Game = c.Value
+	case "created_at", "updated_at":
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return ch, ErrInvalidCursor
+		}
+		ch.CreatedAt, ch.UpdatedAt = t, t
+	}
+	return ch, nil
+}
+
+// filter returns a copy of the characters matching keep
+func (m *MemoryCharacterRepository) filter(keep func(models.Character) bool) []models.Character {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	characters := []models.Character{}
+	for _, c := range m.data {
+		if keep(c) {
+			characters = append(characters, c)
+		}
+	}
+	return characters
+}
+
+func (m *MemoryCharacterRepository) Get(ctx context.Context, id int) (models.Character, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	c, ok := m.data[id]
+	if !ok || c.DeletedAt != nil {
+		return models.Character{}, ErrNotFound
+	}
+	return c, nil
+}
+
+// searchWeights mirrors the setweight labels of the PostgreSQL search_vector
+var searchWeights = map[string]float64{"name": 1.0, "role": 0.4, "game": 0.2}
+
+func (m *MemoryCharacterRepository) Search(ctx context.Context, query string, limit int) ([]models.CharacterSearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []models.CharacterSearchResult{}, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	characters := m.filter(func(c models.Character) bool { return c.DeletedAt == nil })
+
+	// full-text stage: every term must prefix-match a word in some field
+	results := []models.CharacterSearchResult{}
+	for _, c := range characters {
+		fields := map[string]string{"name": c.Name, "role": c.Role, "game": c.Game}
+		score := 0.0
+		for _, t := range terms {
+			best := 0.0
+			for field, text := range fields {
+				if prefixMatch(t, text) {
+					best = max(best, searchWeights[field])
+				}
+			}
+			if best == 0 {
+				score = 0
+				break
+			}
+			score += best
+		}
+		if score == 0 {
+			continue
+		}
+		results = append(results, models.CharacterSearchResult{
+			Character: c,
+			Score:     score / float64(len(terms)),
+			Highlights: highlightFields(c.Name, c.Role, c.Game, func(word string) bool {
+				for _, t := range terms {
+					if strings.HasPrefix(strings.ToLower(word), t) {
+						return true
+					}
+				}
+				return false
+			}),
+		})
+	}
+
+	// fuzzy stage: fall back to trigram similarity for typos
+	if len(results) == 0 {
+		for _, c := range characters {
+			score := max(fuzzyScore(terms, c.Name), fuzzyScore(terms, c.Role), fuzzyScore(terms, c.Game))
+			if score < fuzzyThreshold {
+				continue
+			}
+			results = append(results, models.CharacterSearchResult{
+				Character:  c,
+				Score:      score,
+				Highlights: highlightFields(c.Name, c.Role, c.Game, func(word string) bool { return fuzzyMatch(terms, word) }),
+			})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *MemoryCharacterRepository) Create(ctx context.Context, c *models.Character) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.lastID++
+	now := time.Now()
+	c.ID = m.lastID
+	c.Version = 1
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	c.DeletedAt = nil
+	m.data[c.ID] = *c
+	m.appendAudit(characterAudit(ctx, ActionCreate, nil, c))
+	return nil
+}
+
+func (m *MemoryCharacterRepository) Update(ctx context.Context, c *models.Character, expectedVersion int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.data[c.ID]
+	if !ok || existing.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if expectedVersion != 0 && existing.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+	before := existing
+	existing.Version++
+	existing.Name = c.Name
+	existing.Role = c.Role
+	existing.Game = c.Game
+	existing.UpdatedAt = time.Now()
+	m.data[c.ID] = existing
+	*c = existing
+	m.appendAudit(characterAudit(ctx, ActionUpdate, &before, c))
+	return nil
+}
+
+func (m *MemoryCharacterRepository) Delete(ctx context.Context, id int, expectedVersion int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data[id]
+	if !ok || c.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if expectedVersion != 0 && c.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+	before := c
+	c.Version++
+	now := time.Now()
+	c.DeletedAt = &now
+	c.UpdatedAt = now
+	m.data[id] = c
+	m.appendAudit(characterAudit(ctx, ActionDelete, &before, &c))
+	return nil
+}
+
+func (m *MemoryCharacterRepository) ListDeleted(ctx context.Context) ([]models.Character, error) {
+	characters := m.filter(func(c models.Character) bool { return c.DeletedAt != nil })
+	sort.Slice(characters, func(i, j int) bool {
+		if !characters[i].DeletedAt.Equal(*characters[j].DeletedAt) {
+			return characters[i].DeletedAt.After(*characters[j].DeletedAt)
+		}
+		return characters[i].ID < characters[j].ID
+	})
+	return characters, nil
+}
+
+func (m *MemoryCharacterRepository) Restore(ctx context.Context, id int) (models.Character, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data[id]
+	if !ok || c.DeletedAt == nil {
+		return models.Character{}, ErrNotFound
+	}
+	before := c
+	c.DeletedAt = nil
+	c.Version++
+	c.UpdatedAt = time.Now()
+	m.data[id] = c
+	m.appendAudit(characterAudit(ctx, ActionRestore, &before, &c))
+	return c, nil
+}
+
+func (m *MemoryCharacterRepository) Purge(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before, ok := m.data[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.data, id)
+	m.appendAudit(characterAudit(ctx, ActionPurge, &before, nil))
+	return nil
+}
+
+// appendAudit records an entry; callers must hold m.mu for writing
+func (m *MemoryCharacterRepository) appendAudit(e models.AuditEntry) {
+	e.ID = int64(len(m.audit) + 1)
+	m.audit = append(m.audit, e)
+}
+
+func (m *MemoryCharacterRepository) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	m.appendAudit(entry)
+	return nil
+}
+
+func (m *MemoryCharacterRepository) ListAudit(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error) {
+	normalizeAuditFilter(&f)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := []models.AuditEntry{}
+	skipped := 0
+	// newest first: walk the append-only log backwards
+	for i := len(m.audit) - 1; i >= 0 && len(entries) < f.Limit; i-- {
+		e := m.audit[i]
+		switch {
+		case f.Entity != "" && e.Entity != f.Entity,
+			f.EntityID != "" && e.EntityID != f.EntityID,
+			f.Actor != "" && e.Actor != f.Actor,
+			f.Action != "" && e.Action != f.Action,
+			!f.Since.IsZero() && e.CreatedAt.Before(f.Since),
+			!f.Until.IsZero() && !e.CreatedAt.Before(f.Until):
+			continue
+		}
+		if skipped < f.Offset {
+			skipped++
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
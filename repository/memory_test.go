@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go-rest/models"
+)
+
+func TestSoftDeleteRestorePurge(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryCharacterRepository()
+	kept := &models.Character{Name: "Arthas", Role: "knight", Game: "Warcraft"}
+	deleted := &models.Character{Name: "Jaina", Role: "mage", Game: "Warcraft"}
+	for _, c := range []*models.Character{kept, deleted} {
+		if err := repo.Create(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(time.Millisecond)
+	if err := repo.Delete(ctx, deleted.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Get(ctx, deleted.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get deleted: err = %v, want ErrNotFound", err)
+	}
+	page, err := repo.List(ctx, ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Items[0].ID != kept.ID {
+		t.Errorf("List after delete = %+v, want only %d", page.Items, kept.ID)
+	}
+	trash, err := repo.ListDeleted(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != deleted.ID {
+		t.Fatalf("trash = %+v, want only %d", trash, deleted.ID)
+	}
+	if trash[0].DeletedAt == nil || !trash[0].UpdatedAt.Equal(*trash[0].DeletedAt) {
+		t.Errorf("updated_at %v does not record the delete at %v", trash[0].UpdatedAt, trash[0].DeletedAt)
+	}
+	if trash[0].Version != deleted.Version+1 {
+		t.Errorf("version after delete = %d, want %d", trash[0].Version, deleted.Version+1)
+	}
+	if err := repo.Delete(ctx, deleted.ID, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete twice: err = %v, want ErrNotFound", err)
+	}
+
+	restored, err := repo.Restore(ctx, deleted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.DeletedAt != nil {
+		t.Error("restored character still has deleted_at")
+	}
+	if _, err := repo.Get(ctx, deleted.ID); err != nil {
+		t.Errorf("Get restored: %v", err)
+	}
+	if _, err := repo.Restore(ctx, deleted.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore live character: err = %v, want ErrNotFound", err)
+	}
+
+	// purge works on live and deleted rows and cannot be undone
+	if err := repo.Purge(ctx, deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Restore(ctx, deleted.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Restore purged: err = %v, want ErrNotFound", err)
+	}
+	if trash, _ := repo.ListDeleted(ctx); len(trash) != 0 {
+		t.Errorf("trash after purge = %+v, want empty", trash)
+	}
+	if err := repo.Purge(ctx, deleted.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Purge twice: err = %v, want ErrNotFound", err)
+	}
+}
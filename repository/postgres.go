@@ -0,0 +1,390 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"go-rest/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PostgresCharacterRepository stores characters in PostgreSQL through pgxpool
+type PostgresCharacterRepository struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresCharacterRepository creates a repository backed by the given pool
+func NewPostgresCharacterRepository(pool *pgxpool.Pool) *PostgresCharacterRepository {
+	return &PostgresCharacterRepository{pool: pool}
+}
+
+const characterColumns = "id, name, role, game, version, created_at, updated_at, deleted_at"
+
+// characterFields returns the scan destinations matching characterColumns
+func characterFields(c *models.Character) []any {
+	return []any{&c.ID, &c.Name, &c.Role, &c.Game, &c.Version, &c.CreatedAt, &c.UpdatedAt, &c.DeletedAt}
+}
+
+func scanCharacter(row pgx.Row, c *models.Character) error {
+	return row.Scan(characterFields(c)...)
+}
+
+func (p *PostgresCharacterRepository) List(ctx context.Context, opts ListOptions) (Page, error) {
+	if err := opts.Normalize(); err != nil {
+		return Page{}, err
+	}
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"deleted_at IS NULL"}
+	if opts.Role != "" {
+		where = append(where, "lower(role) = lower("+arg(opts.Role)+")")
+	}
+	if opts.Game != "" {
+		where = append(where, "lower(game) = lower("+arg(opts.Game)+")")
+	}
+	if !opts.CreatedAfter.IsZero() {
+		where = append(where, "created_at >= "+arg(opts.CreatedAfter))
+	}
+	if !opts.CreatedBefore.IsZero() {
+		where = append(where, "created_at < "+arg(opts.CreatedBefore))
+	}
+
+	var page Page
+	if err := p.pool.QueryRow(ctx,
+		"SELECT count(*) FROM characters WHERE "+strings.Join(where, " AND "), args...,
+	).Scan(&page.Total); err != nil {
+		return Page{}, err
+	}
+
+	dir, cmp := "ASC", ">"
+	if opts.Desc {
+		dir, cmp = "DESC", "<"
+	}
+	if c := opts.Cursor; c != nil {
+		switch opts.Sort {
+		case "id":
+			where = append(where, "id "+cmp+" "+arg(c.ID))
+		case "created_at", "updated_at":
+			where = append(where, "("+opts.Sort+", id) "+cmp+" ("+arg(c.Value)+"::timestamptz, "+arg(c.ID)+")")
+		default:
+			where = append(where, "("+opts.Sort+", id) "+cmp+" ("+arg(c.Value)+"::text, "+arg(c.ID)+")")
+		}
+	}
+
+	// fetch one extra row to know whether there is a next page
+	query := "SELECT " + characterColumns + " FROM characters WHERE " + strings.Join(where, " AND ") +
+		" ORDER BY " + opts.Sort + " " + dir + ", id " + dir +
+		" LIMIT " + arg(opts.Limit+1) + " OFFSET " + arg(opts.Offset)
+	items, err := p.queryCharacters(ctx, query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	if len(items) > opts.Limit {
+		items = items[:opts.Limit]
+		page.NextCursor = cursorFor(items[len(items)-1], opts)
+	}
+	page.Items = items
+	return page, nil
+}
+
+func (p *PostgresCharacterRepository) queryCharacters(ctx context.Context, query string, args ...any) ([]models.Character, error) {
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	characters := []models.Character{}
+	for rows.Next() {
+		var c models.Character
+		if err := scanCharacter(rows, &c); err != nil {
+			return nil, err
+		}
+		characters = append(characters, c)
+	}
+	return characters, rows.Err()
+}
+
+func (p *PostgresCharacterRepository) Get(ctx context.Context, id int) (models.Character, error) {
+	var c models.Character
+	err := scanCharacter(p.pool.QueryRow(ctx,
+		"SELECT "+characterColumns+" FROM characters WHERE id=$1 AND deleted_at IS NULL", id,
+	), &c)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c, ErrNotFound
+	}
+	return c, err
+}
+
+func (p *PostgresCharacterRepository) Search(ctx context.Context, query string, limit int) ([]models.CharacterSearchResult, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []models.CharacterSearchResult{}, nil
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+
+	results, err := p.fullTextSearch(ctx, terms, limit)
+	if err != nil || len(results) > 0 {
+		return results, err
+	}
+	return p.trigramSearch(ctx, terms, limit)
+}
+
+// fullTextSearch ranks rows by the weighted search_vector (name > role > game)
+func (p *PostgresCharacterRepository) fullTextSearch(ctx context.Context, terms []string, limit int) ([]models.CharacterSearchResult, error) {
+	const headline = `StartSel="` + headlineStart + `", StopSel="` + headlineStop + `", HighlightAll=true`
+	rows, err := p.pool.Query(ctx, `
+		SELECT `+characterColumns+`, ts_rank(search_vector, q) AS score,
+			ts_headline('simple', name, q, $3), ts_headline('simple', role, q, $3), ts_headline('simple', game, q, $3)
+		FROM characters, to_tsquery('simple', $1) q
+		WHERE deleted_at IS NULL AND search_vector @@ q
+		ORDER BY score DESC, id
+		LIMIT $2`,
+		prefixTSQuery(terms), limit, headline,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.CharacterSearchResult{}
+	for rows.Next() {
+		var res models.CharacterSearchResult
+		var name, role, game string
+		c := &res.Character
+		if err := rows.Scan(append(characterFields(c), &res.Score, &name, &role, &game)...); err != nil {
+			return nil, err
+		}
+		res.Highlights = map[string]string{}
+		for field, h := range map[string]string{"name": name, "role": role, "game": game} {
+			if marked, ok := markHeadline(h); ok {
+				res.Highlights[field] = marked
+			}
+		}
+		results = append(results, res)
+	}
+	return results, rows.Err()
+}
+
+// trigramSearch finds typo-tolerant matches through pg_trgm word similarity
+func (p *PostgresCharacterRepository) trigramSearch(ctx context.Context, terms []string, limit int) ([]models.CharacterSearchResult, error) {
+	tx, err := p.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the <% operator uses the trigram indexes with this threshold
+	if _, err := tx.Exec(ctx, "SELECT set_config('pg_trgm.word_similarity_threshold', $1, true)",
+		strconv.FormatFloat(fuzzyThreshold, 'f', -1, 64)); err != nil {
+		return nil, err
+	}
+
+	q := strings.Join(terms, " ")
+	rows, err := tx.Query(ctx, `
+		SELECT `+characterColumns+`,
+			greatest(word_similarity($1, name), word_similarity($1, role), word_similarity($1, game)) AS score
+		FROM characters
+		WHERE deleted_at IS NULL AND ($1 <% name OR $1 <% role OR $1 <% game)
+		ORDER BY score DESC, id
+		LIMIT $2`,
+		q, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []models.CharacterSearchResult{}
+	for rows.Next() {
+		var res models.CharacterSearchResult
+		c := &res.Character
+		if err := rows.Scan(append(characterFields(c), &res.Score)...); err != nil {
+			return nil, err
+		}
+		res.Highlights = highlightFields(c.Name, c.Role, c.Game, func(word string) bool { return fuzzyMatch(terms, word) })
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, tx.Commit(ctx)
+}
+
+func (p *PostgresCharacterRepository) Create(ctx context.Context, c *models.Character) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			"INSERT INTO characters (name, role, game) VALUES ($1, $2, $3) RETURNING id, version, created_at, updated_at",
+			c.Name, c.Role, c.Game,
+		).Scan(&c.ID, &c.Version, &c.CreatedAt, &c.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, characterAudit(ctx, ActionCreate, nil, c))
+	})
+}
+
+func (p *PostgresCharacterRepository) Update(ctx context.Context, c *models.Character, expectedVersion int) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		before, err := lockCharacter(ctx, tx, c.ID, false)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != 0 && before.Version != expectedVersion {
+			return ErrVersionConflict
+		}
+		if err := scanCharacter(tx.QueryRow(ctx,
+			"UPDATE characters SET name=$1, role=$2, game=$3, version=version+1, updated_at=NOW() WHERE id=$4 RETURNING "+characterColumns,
+			c.Name, c.Role, c.Game, c.ID,
+		), c); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, characterAudit(ctx, ActionUpdate, &before, c))
+	})
+}
+
+func (p *PostgresCharacterRepository) Delete(ctx context.Context, id int, expectedVersion int) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		before, err := lockCharacter(ctx, tx, id, false)
+		if err != nil {
+			return err
+		}
+		if expectedVersion != 0 && before.Version != expectedVersion {
+			return ErrVersionConflict
+		}
+		var after models.Character
+		if err := scanCharacter(tx.QueryRow(ctx,
+			"UPDATE characters SET deleted_at=NOW(), version=version+1, updated_at=NOW() WHERE id=$1 RETURNING "+characterColumns, id,
+		), &after); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, characterAudit(ctx, ActionDelete, &before, &after))
+	})
+}
+
+func (p *PostgresCharacterRepository) ListDeleted(ctx context.Context) ([]models.Character, error) {
+	return p.queryCharacters(ctx, "SELECT "+characterColumns+" FROM characters WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id")
+}
+
+func (p *PostgresCharacterRepository) Restore(ctx context.Context, id int) (models.Character, error) {
+	var c models.Character
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		before, err := lockCharacter(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+		if err := scanCharacter(tx.QueryRow(ctx,
+			"UPDATE characters SET deleted_at=NULL, version=version+1, updated_at=NOW() WHERE id=$1 RETURNING "+characterColumns, id,
+		), &c); err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, characterAudit(ctx, ActionRestore, &before, &c))
+	})
+	return c, err
+}
+
+func (p *PostgresCharacterRepository) Purge(ctx context.Context, id int) error {
+	return pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		var before models.Character
+		err := scanCharacter(tx.QueryRow(ctx,
+			"DELETE FROM characters WHERE id=$1 RETURNING "+characterColumns, id,
+		), &before)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		return insertAudit(ctx, tx, characterAudit(ctx, ActionPurge, &before, nil))
+	})
+}
+
+// lockCharacter reads a character FOR UPDATE inside tx; deleted selects the trash instead of live rows
+func lockCharacter(ctx context.Context, tx pgx.Tx, id int, deleted bool) (models.Character, error) {
+	cond := "deleted_at IS NULL"
+	if deleted {
+		cond = "deleted_at IS NOT NULL"
+	}
+	var c models.Character
+	err := scanCharacter(tx.QueryRow(ctx,
+		"SELECT "+characterColumns+" FROM characters WHERE id=$1 AND "+cond+" FOR UPDATE", id,
+	), &c)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c, ErrNotFound
+	}
+	return c, err
+}
+
+// execer lets insertAudit share the transaction of the mutation it records
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// insertAudit writes an audit row; pass the mutation's transaction so both commit together
+func insertAudit(ctx context.Context, db execer, e models.AuditEntry) error {
+	if e.Changes == nil {
+		e.Changes = map[string]models.FieldChange{}
+	}
+	_, err := db.Exec(ctx,
+		"INSERT INTO audit_log (entity, entity_id, action, actor, changes) VALUES ($1, $2, $3, $4, $5)",
+		e.Entity, e.EntityID, e.Action, e.Actor, e.Changes,
+	)
+	return err
+}
+
+func (p *PostgresCharacterRepository) RecordAudit(ctx context.Context, entry models.AuditEntry) error {
+	return insertAudit(ctx, p.pool, entry)
+}
+
+func (p *PostgresCharacterRepository) ListAudit(ctx context.Context, f AuditFilter) ([]models.AuditEntry, error) {
+	normalizeAuditFilter(&f)
+
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"TRUE"}
+	for col, v := range map[string]string{"entity": f.Entity, "entity_id": f.EntityID, "actor": f.Actor, "action": f.Action} {
+		if v != "" {
+			where = append(where, col+" = "+arg(v))
+		}
+	}
+	if !f.Since.IsZero() {
+		where = append(where, "created_at >= "+arg(f.Since))
+	}
+	if !f.Until.IsZero() {
+		where = append(where, "created_at < "+arg(f.Until))
+	}
+
+	rows, err := p.pool.Query(ctx,
+		"SELECT id, entity, entity_id, action, actor, changes, created_at FROM audit_log WHERE "+strings.Join(where, " AND ")+
+			" ORDER BY created_at DESC, id DESC LIMIT "+arg(f.Limit)+" OFFSET "+arg(f.Offset),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.ID, &e.Entity, &e.EntityID, &e.Action, &e.Actor, &e.Changes, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
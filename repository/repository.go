@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go-rest/models"
+)
+
+var (
+	// ErrNotFound is returned when the requested character does not exist
+	ErrNotFound = errors.New("character not found")
+	// ErrVersionConflict is returned when the character changed since the expected version
+	ErrVersionConflict = errors.New("character version conflict")
+)
+
+// CharacterRepository abstracts the storage used by the character handlers
+type CharacterRepository interface {
+	// List returns one page of characters that are not soft deleted
+	List(ctx context.Context, opts ListOptions) (Page, error)
+	// Get returns a single character by ID, hiding soft deleted rows
+	Get(ctx context.Context, id int) (models.Character, error)
+	// Search ranks characters by full-text match on name, role and game,
+	// falling back to trigram similarity when nothing matches exactly
+	Search(ctx context.Context, query string, limit int) ([]models.CharacterSearchResult, error)
+	// Create stores a new character and fills in its ID and timestamps
+	Create(ctx context.Context, c *models.Character) error
+	// Update overwrites name, role and game of an existing character and bumps its version.
+	// A non-zero expectedVersion makes the update fail with ErrVersionConflict if the stored version differs.
+	Update(ctx context.Context, c *models.Character, expectedVersion int) error
+	// Delete soft deletes a character by setting deleted_at, honoring expectedVersion like Update
+	Delete(ctx context.Context, id int, expectedVersion int) error
+	// ListDeleted returns the soft deleted characters (the trash)
+	ListDeleted(ctx context.Context) ([]models.Character, error)
+	// Restore clears deleted_at of a soft deleted character
+	Restore(ctx context.Context, id int) (models.Character, error)
+	// Purge permanently removes a character, deleted or not
+	Purge(ctx context.Context, id int) error
+}
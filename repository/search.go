@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"html"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DefaultSearchLimit is used when the client does not ask for a result count
+	DefaultSearchLimit = 20
+	// fuzzyThreshold is the minimum trigram word similarity for typo-tolerant matches
+	fuzzyThreshold = 0.3
+
+	// highlights are HTML: the text is escaped and only these tags are raw
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+
+	// headlineStart and headlineStop delimit matches in ts_headline output; control
+	// characters so they cannot be confused with markup stored in a character
+	headlineStart = "\x02"
+	headlineStop  = "\x03"
+)
+
+// searchTerms splits a free-text query into lowercase words, dropping punctuation
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// prefixTSQuery builds a to_tsquery expression matching every term as a prefix
+func prefixTSQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = t + ":*"
+	}
+	return strings.Join(parts, " & ")
+}
+
+// trigrams returns the pg_trgm style trigram set of a single word
+func trigrams(word string) map[string]bool {
+	padded := []rune("  " + strings.ToLower(word) + " ")
+	set := make(map[string]bool, len(padded))
+	for i := 0; i+3 <= len(padded); i++ {
+		set[string(padded[i:i+3])] = true
+	}
+	return set
+}
+
+// wordSimilarity mirrors pg_trgm word_similarity for a single term and word:
+// the share of the term's trigrams that also appear in the word
+func wordSimilarity(term, word string) float64 {
+	t := trigrams(term)
+	if len(t) == 0 {
+		return 0
+	}
+	w := trigrams(word)
+	shared := 0
+	for g := range t {
+		if w[g] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(t))
+}
+
+// fuzzyScore averages, over all terms, the best similarity against any word of text
+func fuzzyScore(terms []string, text string) float64 {
+	words := searchTerms(text)
+	if len(terms) == 0 || len(words) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, t := range terms {
+		best := 0.0
+		for _, w := range words {
+			best = max(best, wordSimilarity(t, w))
+		}
+		total += best
+	}
+	return total / float64(len(terms))
+}
+
+// prefixMatch reports whether any word of text starts with term
+func prefixMatch(term, text string) bool {
+	for _, w := range searchTerms(text) {
+		if strings.HasPrefix(w, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// fuzzyMatch reports whether word is similar enough to any of the terms
+func fuzzyMatch(terms []string, word string) bool {
+	for _, t := range terms {
+		if strings.HasPrefix(strings.ToLower(word), t) || wordSimilarity(t, word) >= fuzzyThreshold {
+			return true
+		}
+	}
+	return false
+}
+
+// highlight HTML-escapes text and wraps every word accepted by match in <mark> tags
+func highlight(text string, match func(word string) bool) (string, bool) {
+	var b strings.Builder
+	found := false
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			b.WriteString(html.EscapeString(string(runes[i])))
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		word := string(runes[i:j])
+		if match(word) {
+			found = true
+			b.WriteString(highlightStart + word + highlightStop)
+		} else {
+			b.WriteString(word)
+		}
+		i = j
+	}
+	return b.String(), found
+}
+
+// markHeadline turns ts_headline output delimited by headlineStart/headlineStop
+// into escaped HTML with <mark> tags, and reports whether it had a match
+func markHeadline(h string) (string, bool) {
+	if !strings.Contains(h, headlineStart) {
+		return "", false
+	}
+	return strings.NewReplacer(headlineStart, highlightStart, headlineStop, highlightStop).
+		Replace(html.EscapeString(h)), true
+}
+
+// highlightFields returns highlighted name, role and game, keeping only fields with a match
+func highlightFields(name, role, game string, match func(word string) bool) map[string]string {
+	highlights := map[string]string{}
+	for field, text := range map[string]string{"name": name, "role": role, "game": game} {
+		if h, ok := highlight(text, match); ok {
+			highlights[field] = h
+		}
+	}
+	return highlights
+}
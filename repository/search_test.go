@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"go-rest/models"
+)
+
+func TestHighlightEscapesHTML(t *testing.T) {
+	repo := NewMemoryCharacterRepository()
+	c := &models.Character{Name: `Mage <img src=x onerror=alert(1)>`, Role: "mage & healer", Game: "Quest"}
+	if err := repo.Create(context.Background(), c); err != nil {
+		t.Fatal(err)
+	}
+	results, err := repo.Search(context.Background(), "mage", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	want := map[string]string{
+		"name": `<mark>Mage</mark> &lt;img src=x onerror=alert(1)&gt;`,
+		"role": `<mark>mage</mark> &amp; healer`,
+	}
+	for field, w := range want {
+		if got := results[0].Highlights[field]; got != w {
+			t.Errorf("highlight %s = %q, want %q", field, got, w)
+		}
+	}
+}
+
+func TestMarkHeadline(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"\x02Mage\x03 <b>x</b>", "<mark>Mage</mark> &lt;b&gt;x&lt;/b&gt;", true},
+		{"<mark>fake</mark>", "", false},
+		{"a \x02b\x03 \"c\"", "a <mark>b</mark> &#34;c&#34;", true},
+	}
+	for _, tt := range tests {
+		got, ok := markHeadline(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("markHeadline(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
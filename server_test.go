@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"go-rest/config"
+	"go-rest/utils"
+)
+
+// shutdownEvents records the order in which the parts of a shutdown finish
+type shutdownEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (e *shutdownEvents) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *shutdownEvents) list() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.events)
+}
+
+// slowServer starts serve on a free local port with a handler that blocks
+// until release is closed, and a background task that records when it stops
+func slowServer(t *testing.T, shutdownTimeout time.Duration, events *shutdownEvents) (addr string, entered, release chan struct{}, done chan error) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr = ln.Addr().String()
+	ln.Close()
+
+	entered, release, done = make(chan struct{}), make(chan struct{}), make(chan error, 1)
+	srv := &http.Server{Addr: addr, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-release
+			events.add("request done")
+		}
+	})}
+	task := func(ctx context.Context) {
+		<-ctx.Done()
+		events.add("task stopped")
+	}
+	// the real sweeper and watcher run too, serve only returns once they have stopped
+	go func() {
+		done <- serve(srv, shutdownTimeout, task,
+			func(ctx context.Context) { utils.RunSweeper(ctx, time.Hour) },
+			func(ctx context.Context) { config.Watch(ctx, "", func(context.Context) {}) })
+	}()
+
+	// the signal handler is installed before the server listens
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := http.Get("http://" + addr + "/")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server did not start: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return addr, entered, release, done
+}
+
+func TestShutdownDrainsRequestsBeforeStoppingTasks(t *testing.T) {
+	events := &shutdownEvents{}
+	addr, entered, release, done := slowServer(t, 5*time.Second, events)
+
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get("http://" + addr + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+	<-entered
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+
+	// new connections are refused while the in-flight request still runs
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("server still accepts connections after SIGTERM")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("serve returned %v before the in-flight request finished", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if got := events.list(); len(got) != 0 {
+		t.Fatalf("%v before the in-flight request finished", got)
+	}
+
+	close(release)
+	if got := <-status; got != http.StatusOK {
+		t.Errorf("in-flight request: status %d, want 200", got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("serve = %v", err)
+	}
+	if got := events.list(); !slices.Equal(got, []string{"request done", "task stopped"}) {
+		t.Errorf("shutdown order %v, want the request drained before the tasks stop", got)
+	}
+}
+
+func TestShutdownTimeoutStillStopsTasks(t *testing.T) {
+	events := &shutdownEvents{}
+	addr, entered, release, done := slowServer(t, 50*time.Millisecond, events)
+	defer close(release)
+
+	go func() {
+		if resp, err := http.Get("http://" + addr + "/slow"); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-entered
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	err := <-done
+	if err == nil || !strings.HasPrefix(err.Error(), "shutdown:") {
+		t.Errorf("serve = %v, want a shutdown timeout error", err)
+	}
+	if got := events.list(); !slices.Equal(got, []string{"task stopped"}) {
+		t.Errorf("events %v, want the task stopped without waiting for the request", got)
+	}
+}
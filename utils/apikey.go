@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned when no API key has the given ID
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrInvalidAPIKey is returned for unknown, expired or revoked API keys
+	ErrInvalidAPIKey = errors.New("invalid api key")
+)
+
+// apiKeyPrefix marks our keys, so leaked keys are easy to find in logs and repositories
+const apiKeyPrefix = "grk_"
+
+// lastUsedResolution limits how often last_used_at is written for a busy key
+const lastUsedResolution = time.Minute
+
+// APIKey is a long-lived credential for service accounts. Only the SHA-256
+// hash of the key is stored; the key itself is shown once when created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// Active reports whether the key may still be used
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// APIKeyStore persists API keys
+type APIKeyStore interface {
+	Create(ctx context.Context, k APIKey) error
+	List(ctx context.Context) ([]APIKey, error)
+	// Lookup finds a key by the hash of its secret
+	Lookup(ctx context.Context, hash string) (APIKey, error)
+	Revoke(ctx context.Context, id string) (APIKey, error)
+	Touch(ctx context.Context, id string, at time.Time) error
+}
+
+var apiKeyStore APIKeyStore = NewMemoryAPIKeyStore()
+
+// SetAPIKeyStore sets the store used for API keys
+func SetAPIKeyStore(s APIKeyStore) {
+	apiKeyStore = s
+}
+
+// CreateAPIKey stores a new key with the given permissions as scopes and returns
+// the plaintext key, which cannot be recovered later
+func CreateAPIKey(ctx context.Context, name string, scopes []string, expiresAt *time.Time, createdBy string) (string, APIKey, error) {
+	if strings.TrimSpace(name) == "" {
+		return "", APIKey{}, errors.New("name is required")
+	}
+	if len(scopes) == 0 {
+		return "", APIKey{}, errors.New("at least one scope is required")
+	}
+	for _, s := range scopes {
+		if !slices.Contains(AllPermissions, s) {
+			return "", APIKey{}, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", APIKey{}, errors.New("expires_at must be in the future")
+	}
+
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	k := APIKey{
+		ID:        strings.ToLower(rand.Text()[:12]),
+		Name:      strings.TrimSpace(name),
+		Hash:      hashToken(key),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+	if err := apiKeyStore.Create(ctx, k); err != nil {
+		return "", APIKey{}, err
+	}
+	return key, k, nil
+}
+
+// ListAPIKeys returns every key, including revoked and expired ones
+func ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	return apiKeyStore.List(ctx)
+}
+
+// RevokeAPIKey disables a key immediately
+func RevokeAPIKey(ctx context.Context, id string) (APIKey, error) {
+	return apiKeyStore.Revoke(ctx, id)
+}
+
+// authenticateAPIKey checks a presented key and records when it was last used
+func authenticateAPIKey(ctx context.Context, key string) (APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	k, err := apiKeyStore.Lookup(ctx, hashToken(key))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return APIKey{}, err
+	}
+	now := time.Now()
+	if !k.Active(now) {
+		return APIKey{}, ErrInvalidAPIKey
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= lastUsedResolution {
+		if err := apiKeyStore.Touch(ctx, k.ID, now); err != nil {
+			return APIKey{}, err
+		}
+	}
+	return k, nil
+}
+
+// ExtractAPIKey reads an API key from the X-API-Key header or the
+// "Authorization: ApiKey <key>" scheme; ok is false when none was sent
+func ExtractAPIKey(r *http.Request) (string, bool) {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key, true
+	}
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) == 2 && strings.EqualFold(parts[0], "ApiKey") {
+		return strings.TrimSpace(parts[1]), true
+	}
+	return "", false
+}
+
+// MemoryAPIKeyStore keeps API keys in process memory, for development
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+// NewMemoryAPIKeyStore creates an empty in-memory API key store
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: map[string]APIKey{}}
+}
+
+func (s *MemoryAPIKeyStore) Create(ctx context.Context, k APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.ID] = k
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.After(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) Lookup(ctx context.Context, hash string) (APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.Hash == hash {
+			return k, nil
+		}
+	}
+	return APIKey{}, ErrAPIKeyNotFound
+}
+
+func (s *MemoryAPIKeyStore) Revoke(ctx context.Context, id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if k.RevokedAt == nil {
+		now := time.Now().UTC()
+		k.RevokedAt = &now
+		s.keys[id] = k
+	}
+	return k, nil
+}
+
+func (s *MemoryAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[id]; ok {
+		at = at.UTC()
+		k.LastUsedAt = &at
+		s.keys[id] = k
+	}
+	return nil
+}
+
+// PostgresAPIKeyStore keeps API keys in the api_keys table
+type PostgresAPIKeyStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresAPIKeyStore creates an API key store backed by pgxpool
+func NewPostgresAPIKeyStore(pool *pgxpool.Pool) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{pool: pool}
+}
+
+const apiKeyColumns = "id, name, key_hash, scopes, created_by, created_at, expires_at, last_used_at, revoked_at"
+
+func scanAPIKey(row pgx.Row) (APIKey, error) {
+	var k APIKey
+	err := row.Scan(&k.ID, &k.Name, &k.Hash, &k.Scopes, &k.CreatedBy, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt)
+	return k, err
+}
+
+func (s *PostgresAPIKeyStore) Create(ctx context.Context, k APIKey) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO api_keys (id, name, key_hash, scopes, created_by, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		k.ID, k.Name, k.Hash, k.Scopes, k.CreatedBy, k.CreatedAt, k.ExpiresAt)
+	return err
+}
+
+func (s *PostgresAPIKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY created_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := []APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresAPIKeyStore) Lookup(ctx context.Context, hash string) (APIKey, error) {
+	k, err := scanAPIKey(s.pool.QueryRow(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash=$1", hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (s *PostgresAPIKeyStore) Revoke(ctx context.Context, id string) (APIKey, error) {
+	k, err := scanAPIKey(s.pool.QueryRow(ctx, `
+		UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id=$1
+		RETURNING `+apiKeyColumns, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	return k, err
+}
+
+func (s *PostgresAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	_, err := s.pool.Exec(ctx, "UPDATE api_keys SET last_used_at=$2 WHERE id=$1", id, at)
+	return err
+}
@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingAPIKeyStore counts how often last_used_at is written
+type countingAPIKeyStore struct {
+	*MemoryAPIKeyStore
+	touches int
+}
+
+func (s *countingAPIKeyStore) Touch(ctx context.Context, id string, at time.Time) error {
+	s.touches++
+	return s.MemoryAPIKeyStore.Touch(ctx, id, at)
+}
+
+// useAPIKeyStore gives the test an empty API key store
+func useAPIKeyStore(t *testing.T) *countingAPIKeyStore {
+	t.Helper()
+	store := &countingAPIKeyStore{MemoryAPIKeyStore: NewMemoryAPIKeyStore()}
+	SetAPIKeyStore(store)
+	t.Cleanup(func() { SetAPIKeyStore(NewMemoryAPIKeyStore()) })
+	return store
+}
+
+// callWithKey sends a request carrying key in the given header through Secure and Require(perm)
+func callWithKey(header, value, perm string) int {
+	handler := Secure(Require(perm, func(w http.ResponseWriter, r *http.Request) {}))
+	req := httptest.NewRequest(http.MethodGet, "/api/characters", nil)
+	req.Header.Set(header, value)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	return rec.Code
+}
+
+func TestAPIKeyIsStoredHashed(t *testing.T) {
+	store := useAPIKeyStore(t)
+	key, k, err := CreateAPIKey(context.Background(), " importer ", []string{PermCharactersRead}, nil, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		t.Errorf("key %q lacks the %s prefix", key, apiKeyPrefix)
+	}
+	stored := store.keys[k.ID]
+	if stored.Hash != hashToken(key) || strings.Contains(stored.Hash, key) {
+		t.Errorf("stored hash %q is not the SHA-256 of the key", stored.Hash)
+	}
+	if stored.Name != "importer" || stored.CreatedBy != "admin" {
+		t.Errorf("stored key = %+v", stored)
+	}
+	data, _ := json.Marshal(stored)
+	if strings.Contains(string(data), stored.Hash) || strings.Contains(string(data), key) {
+		t.Errorf("JSON of a key exposes its secret: %s", data)
+	}
+}
+
+func TestCreateAPIKeyValidation(t *testing.T) {
+	useAPIKeyStore(t)
+	past := time.Now().Add(-time.Hour)
+	tests := map[string]struct {
+		name      string
+		scopes    []string
+		expiresAt *time.Time
+	}{
+		"no name":       {"", []string{PermCharactersRead}, nil},
+		"no scopes":     {"ci", nil, nil},
+		"unknown scope": {"ci", []string{"characters:everything"}, nil},
+		"expired":       {"ci", []string{PermCharactersRead}, &past},
+	}
+	for name, tt := range tests {
+		if _, _, err := CreateAPIKey(context.Background(), tt.name, tt.scopes, tt.expiresAt, "admin"); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestAPIKeyScopesAndSchemes(t *testing.T) {
+	useAPIKeyStore(t)
+	key, _, err := CreateAPIKey(context.Background(), "reader", []string{PermCharactersRead}, nil, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, header, value, perm string
+		want                      int
+	}{
+		{"X-API-Key in scope", "X-API-Key", key, PermCharactersRead, http.StatusOK},
+		{"ApiKey scheme in scope", "Authorization", "ApiKey " + key, PermCharactersRead, http.StatusOK},
+		{"scheme is case-insensitive", "Authorization", "apikey " + key, PermCharactersRead, http.StatusOK},
+		{"out of scope", "X-API-Key", key, PermCharactersWrite, http.StatusForbidden},
+		{"out of scope via scheme", "Authorization", "ApiKey " + key, PermAuditRead, http.StatusForbidden},
+		{"unknown key", "X-API-Key", apiKeyPrefix + "unknown", PermCharactersRead, http.StatusUnauthorized},
+		{"not an API key", "X-API-Key", "secret", PermCharactersRead, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := callWithKey(tt.header, tt.value, tt.perm); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRevokedAndExpiredAPIKeysAreRejected(t *testing.T) {
+	store := useAPIKeyStore(t)
+	ctx := context.Background()
+	revoked, k, err := CreateAPIKey(ctx, "revoked", []string{PermCharactersRead}, nil, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := callWithKey("X-API-Key", revoked, PermCharactersRead); got != http.StatusOK {
+		t.Fatalf("before revoke: status %d", got)
+	}
+	if _, err := RevokeAPIKey(ctx, k.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := callWithKey("X-API-Key", revoked, PermCharactersRead); got != http.StatusUnauthorized {
+		t.Errorf("revoked key: status %d, want 401", got)
+	}
+	if _, err := RevokeAPIKey(ctx, "missing"); err != ErrAPIKeyNotFound {
+		t.Errorf("revoke unknown key: err = %v, want ErrAPIKeyNotFound", err)
+	}
+
+	// expiry cannot be set in the past, so age a key in the store
+	expired, k, err := CreateAPIKey(ctx, "expired", []string{PermCharactersRead}, nil, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := store.keys[k.ID]
+	past := time.Now().Add(-time.Second)
+	stored.ExpiresAt = &past
+	store.keys[k.ID] = stored
+	if got := callWithKey("Authorization", "ApiKey "+expired, PermCharactersRead); got != http.StatusUnauthorized {
+		t.Errorf("expired key: status %d, want 401", got)
+	}
+}
+
+func TestAPIKeyLastUsedIsThrottled(t *testing.T) {
+	store := useAPIKeyStore(t)
+	key, k, err := CreateAPIKey(context.Background(), "busy", []string{PermCharactersRead}, nil, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 5 {
+		if got := callWithKey("X-API-Key", key, PermCharactersRead); got != http.StatusOK {
+			t.Fatalf("status %d", got)
+		}
+	}
+	if store.touches != 1 {
+		t.Errorf("%d last_used_at writes for 5 requests in a row, want 1", store.touches)
+	}
+	if store.keys[k.ID].LastUsedAt == nil {
+		t.Fatal("last_used_at not set")
+	}
+
+	stored := store.keys[k.ID]
+	earlier := time.Now().Add(-lastUsedResolution)
+	stored.LastUsedAt = &earlier
+	store.keys[k.ID] = stored
+	callWithKey("X-API-Key", key, PermCharactersRead)
+	if store.touches != 2 {
+		t.Errorf("%d last_used_at writes after the resolution passed, want 2", store.touches)
+	}
+}
@@ -1,125 +1,294 @@
 package utils
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
+	"slices"
 	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"gopkg.in/yaml.v3"
 )
 
 type User struct {
-	Username string `yaml:"username" json:"username"`
-	Password string `yaml:"password" json:"password"`
+	Username string   `yaml:"username" json:"username"`
+	Password string   `yaml:"password" json:"password"`
+	Roles    []string `yaml:"roles" json:"roles"`
+	// Disabled users cannot log in and their tokens are rejected
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled,omitempty"`
 }
 
+// AppConfig is the users and access policy part of the configuration
 type AppConfig struct {
 	Users []User `yaml:"users"`
+	// Roles optionally overrides or adds role -> permissions entries
+	Roles map[string][]string `yaml:"roles"`
+	// Login configures brute-force protection, empty fields use DefaultLoginPolicy
+	Login LoginPolicy `yaml:"login"`
+	// RateLimits configures request limits, DefaultRateLimitConfig when missing
+	RateLimits *RateLimitConfig `yaml:"rate_limits"`
 }
 
+// Claims are the JWT claims issued by IssueTokens
+type Claims struct {
+	Roles []string `json:"roles,omitempty"`
+	// FamilyID links an access token to the refresh token family it was issued with
+	FamilyID string `json:"fid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Default token lifetimes, changed with SetTokenTTLs
+const (
+	DefaultAccessTokenTTL  = 1 * time.Hour
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
 var (
-	appUsers []User
+	accessTokenTTL  = DefaultAccessTokenTTL
+	refreshTokenTTL = DefaultRefreshTokenTTL
+)
 
-	// JWT config
-	jwtSecret []byte
+// SetTokenTTLs sets the lifetime of newly issued access and refresh tokens
+func SetTokenTTLs(access, refresh time.Duration) {
+	accessTokenTTL = access
+	refreshTokenTTL = refresh
+}
 
-	// logout blacklist: store revoked JWT IDs (jti) until expiry
-	revokedJTI   = make(map[string]time.Time)
-	revokedMutex sync.RWMutex
+// userSet is the active users and role table. ApplyAppConfig replaces it as a
+// whole, so a request never sees the users of one config with the roles of another.
+type userSet struct {
+	users map[string]User
+	roles map[string][]string
+}
 
-	// refresh tokens store: token -> username, expiry
-	refreshStore = make(map[string]time.Time)
-	refreshOwner = make(map[string]string)
-	refreshMutex sync.RWMutex
-)
+var activeUsers atomic.Pointer[userSet]
+
+func init() {
+	activeUsers.Store(&userSet{roles: defaultRolePermissions})
+}
+
+// userActive reports whether username is configured and not disabled
+func userActive(username string) bool {
+	u, ok := activeUsers.Load().users[username]
+	return ok && !u.Disabled
+}
+
+// ValidateAppConfig checks users, roles and rate limits without activating them
+func ValidateAppConfig(cfg AppConfig) error {
+	cfg.Users = slices.Clone(cfg.Users)
+	_, err := prepareAppConfig(&cfg, "")
+	return err
+}
 
-// LoadUsersFromYAML loads users from config YAML file
-func LoadUsersFromYAML(filename string) error {
-	data, err := os.ReadFile(filename)
+// ApplyAppConfig validates and activates users, roles, login policy and rate
+// limits; source names where cfg came from in warnings
+func ApplyAppConfig(cfg AppConfig, source string) error {
+	roles, err := prepareAppConfig(&cfg, source)
 	if err != nil {
 		return err
 	}
-	var cfg AppConfig
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	limits := DefaultRateLimitConfig
+	if cfg.RateLimits != nil {
+		limits = *cfg.RateLimits
+	}
+	if err := SetRateLimitConfig(limits); err != nil {
 		return err
 	}
-	appUsers = cfg.Users
-	if len(jwtSecret) == 0 {
-		secret := os.Getenv("JWT_SECRET")
-		if secret == "" {
-			secret = "dev-secret-change" // for development only
-		}
-		jwtSecret = []byte(secret)
+	users := make(map[string]User, len(cfg.Users))
+	for _, u := range cfg.Users {
+		users[u.Username] = u
 	}
+	activeUsers.Store(&userSet{users: users, roles: roles})
+	SetLoginPolicy(cfg.Login)
 	return nil
 }
 
-// Authenticate checks if username/password exists in config
-func Authenticate(username, password string) bool {
-	for _, u := range appUsers {
-		if u.Username == username && u.Password == password {
-			return true
+// ErrTokenRevocation is returned by ReloadAppConfig when the new config was
+// applied but the tokens of a removed or disabled user could not be revoked
+var ErrTokenRevocation = errors.New("token revocation failed")
+
+// ReloadAppConfig applies cfg like ApplyAppConfig and revokes the tokens of every
+// user that was active before and is now removed or disabled. On a validation
+// error the previous config stays active; an error wrapping ErrTokenRevocation
+// means cfg is active.
+func ReloadAppConfig(ctx context.Context, cfg AppConfig, source string) error {
+	old := activeUsers.Load()
+	if err := ApplyAppConfig(cfg, source); err != nil {
+		return err
+	}
+	var errs []error
+	for name, u := range old.users {
+		if u.Disabled || userActive(name) {
+			continue
 		}
+		n, err := RevokeUserTokens(ctx, name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("user %q: %w", name, err))
+			continue
+		}
+		slog.InfoContext(ctx, "user removed or disabled, tokens revoked", "user", name, "refresh_tokens", n)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrTokenRevocation, errors.Join(errs...))
 	}
-	return false
+	return nil
+}
+
+// RevokeUserTokens revokes every refresh token of username and the access
+// tokens issued with them, and returns the number of refresh tokens revoked
+func RevokeUserTokens(ctx context.Context, username string) (int, error) {
+	tokens, err := refreshStore.RevokeUser(ctx, username)
+	if err != nil {
+		return 0, err
+	}
+	return len(tokens), revokeAccessTokens(ctx, tokens)
 }
 
-// CreateToken issues a JWT with subject=username, expiry, and jti
-func CreateToken(username string) (string, error) {
-	// 1 hour expiry for training purposes
-	expiresAt := time.Now().Add(1 * time.Hour)
-	claims := jwt.RegisteredClaims{
-		Subject:   username,
-		ExpiresAt: jwt.NewNumericDate(expiresAt),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		ID:        generateJTI(),
+// prepareAppConfig validates cfg, fills in default user roles and returns the
+// role table; plaintext passwords are only warned about when source is set
+func prepareAppConfig(cfg *AppConfig, source string) (map[string][]string, error) {
+	roles, err := buildRolePermissions(cfg.Roles)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(cfg.Users))
+	for i, u := range cfg.Users {
+		if u.Username == "" {
+			return nil, fmt.Errorf("user %d: username is required", i+1)
+		}
+		if seen[u.Username] {
+			return nil, fmt.Errorf("user %q: duplicate username", u.Username)
+		}
+		seen[u.Username] = true
+		if len(u.Roles) == 0 {
+			// users without explicit roles may only read
+			cfg.Users[i].Roles = []string{RoleViewer}
+		}
+		for _, role := range cfg.Users[i].Roles {
+			if _, ok := roles[role]; !ok {
+				return nil, fmt.Errorf("user %q: unknown role %q", u.Username, role)
+			}
+		}
+		if !IsPasswordHash(u.Password) {
+			if strings.HasPrefix(u.Password, "$") {
+				return nil, fmt.Errorf("user %q: %w", u.Username, ErrUnknownHash)
+			}
+			if source == "" {
+				continue
+			}
+			slog.Warn("plaintext password in config, replace it with the output of `go-rest hash-password`",
+				"user", u.Username, "file", source)
+		}
+	}
+	if cfg.RateLimits != nil {
+		if err := cfg.RateLimits.Validate(); err != nil {
+			return nil, err
+		}
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return roles, nil
 }
 
-// IsTokenValid verifies JWT signature, expiry, and blacklist
-func IsTokenValid(tokenString string) bool {
-	claims := &jwt.RegisteredClaims{}
-	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+// UsersLoaded reports whether config.yaml provided at least one user
+func UsersLoaded() bool {
+	return len(activeUsers.Load().users) > 0
+}
+
+// Authenticate checks username/password against the configured users.
+// Unknown usernames are checked against a dummy hash so both cases take similar time;
+// disabled users are checked like known ones but always fail.
+func Authenticate(username, password string) bool {
+	stored := dummyHash
+	found := false
+	if u, ok := activeUsers.Load().users[username]; ok {
+		stored, found = u.Password, !u.Disabled
+	}
+	ok, err := VerifyPassword(stored, password)
 	if err != nil {
+		slog.Error("password check failed", "user", username, "error", err)
 		return false
 	}
+	return found && ok
+}
+
+// UserRoles returns the roles configured for a user
+func UserRoles(username string) []string {
+	return activeUsers.Load().users[username].Roles
+}
+
+func signAccessToken(username, familyID, jti string, expiresAt time.Time) (string, error) {
+	claims := Claims{
+		Roles:    UserRoles(username),
+		FamilyID: familyID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   username,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			ID:        jti,
+		},
+	}
+	return signToken(claims)
+}
+
+// ErrInvalidToken is wrapped by ParseToken errors for tokens that must be
+// rejected; any other error means the token could not be checked
+var ErrInvalidToken = errors.New("invalid token")
+
+// ParseToken verifies JWT signature, expiry, and revocation and returns its claims.
+// Tokens of users that were removed from the config or disabled are rejected.
+func ParseToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	_, span := tracer.Start(ctx, "jwt.parse")
+	err := parseClaims(tokenString, claims)
+	if err != nil {
+		failSpan(span, err)
+	}
+	span.End()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !userActive(claims.Subject) {
+		return nil, fmt.Errorf("%w: user removed or disabled", ErrInvalidToken)
+	}
 	// check revocation by jti
-	if claims.ID != "" {
-		revokedMutex.RLock()
-		exp, found := revokedJTI[claims.ID]
-		revokedMutex.RUnlock()
-		if found && time.Now().Before(exp) {
-			return false
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		revoked, err := isJTIRevoked(ctx, claims.ID, claims.ExpiresAt.Time)
+		if err != nil {
+			return nil, fmt.Errorf("revocation check: %w", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("%w: token revoked", ErrInvalidToken)
 		}
 	}
-	return true
+	return claims, nil
 }
 
-// InvalidateToken revokes a JWT by its jti until its expiry time
-func InvalidateToken(tokenString string) {
-	claims := &jwt.RegisteredClaims{}
-	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
-	if err != nil {
-		return
+// InvalidateToken revokes a JWT by its jti until its expiry time, together with
+// the refresh token family it was issued with, so the session cannot be renewed
+func InvalidateToken(ctx context.Context, tokenString string) error {
+	claims := &Claims{}
+	if err := parseClaims(tokenString, claims); err != nil {
+		return nil
 	}
-	if claims.ID == "" || claims.ExpiresAt == nil {
-		return
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := revokeJTI(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+			return err
+		}
+	}
+	if claims.FamilyID == "" {
+		return nil
+	}
+	family, err := refreshStore.RevokeFamily(ctx, claims.FamilyID)
+	if err != nil {
+		return err
 	}
-	revokedMutex.Lock()
-	revokedJTI[claims.ID] = claims.ExpiresAt.Time
-	revokedMutex.Unlock()
+	return revokeAccessTokens(ctx, family)
 }
 
 // ExtractBearerToken extracts Bearer token from Authorization header
@@ -141,45 +310,105 @@ func ExtractBearerToken(r *http.Request) (string, error) {
 
 // Secure moved to utils/middleware.go
 
-// generateJTI creates a simple unique ID for JWT ID claim
+// generateJTI creates an unguessable 128-bit ID for the JWT ID claim
 func generateJTI() string {
-	return strconv.FormatInt(time.Now().UnixNano(), 36)
+	return rand.Text()
 }
 
-// CreateRefreshToken creates a long-lived opaque refresh token
-func CreateRefreshToken(username string) (string, error) {
-	token := generateJTI()
-	exp := time.Now().Add(7 * 24 * time.Hour)
-	refreshMutex.Lock()
-	refreshStore[token] = exp
-	refreshOwner[token] = username
-	refreshMutex.Unlock()
-	return token, nil
+// generateRefreshToken creates an opaque 256-bit refresh token
+func generateRefreshToken() string {
+	b := make([]byte, 32)
+	rand.Read(b) // never returns an error, crashes the program instead
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// IssueTokens creates an access token and a long-lived opaque refresh token that
+// start a new token family; only the refresh token's hash is stored
+func IssueTokens(ctx context.Context, username string, meta RefreshMeta) (string, string, error) {
+	refresh, record := newRefreshToken(meta)
+	record.Username = username
+	record.FamilyID = generateJTI()
+	if err := refreshStore.Save(ctx, record); err != nil {
+		return "", "", err
+	}
+	access, err := signAccessToken(username, record.FamilyID, record.AccessJTI, record.AccessExpiresAt)
+	if err != nil {
+		return "", "", err
+	}
+	return access, refresh, nil
+}
+
+// newRefreshToken prepares a refresh token and the ID of the access token issued with it
+func newRefreshToken(meta RefreshMeta) (string, RefreshToken) {
+	token := generateRefreshToken()
+	now := time.Now()
+	return token, RefreshToken{
+		Hash:            hashToken(token),
+		AccessJTI:       generateJTI(),
+		AccessExpiresAt: now.Add(accessTokenTTL),
+		IssuedAt:        now,
+		ExpiresAt:       now.Add(refreshTokenTTL),
+		UserAgent:       meta.UserAgent,
+		IP:              meta.IP,
+	}
 }
 
 // ValidateAndRotateRefresh validates a refresh token and rotates it
-// Returns new access token and new refresh token
-func ValidateAndRotateRefresh(old string) (string, string, error) {
-	refreshMutex.Lock()
-	exp, ok := refreshStore[old]
-	username := refreshOwner[old]
-	if !ok || time.Now().After(exp) {
-		refreshMutex.Unlock()
-		return "", "", errors.New("invalid refresh token")
-	}
-	// revoke old
-	delete(refreshStore, old)
-	delete(refreshOwner, old)
-	refreshMutex.Unlock()
-
-	// mint new pair
-	access, err := CreateToken(username)
+// Returns new access token and new refresh token.
+// Presenting a token that was already rotated revokes its whole family.
+func ValidateAndRotateRefresh(ctx context.Context, old string, meta RefreshMeta) (string, string, error) {
+	newRefresh, next := newRefreshToken(meta)
+	consumed, err := refreshStore.Rotate(ctx, hashToken(old), next)
+	if err == nil || errors.Is(err, ErrRefreshTokenReused) {
+		if !userActive(consumed.Username) {
+			// removed or disabled since login: its tokens were revoked on reload,
+			// which is not a replay
+			refreshRotations.WithLabelValues("invalid").Inc()
+			return "", "", ErrInvalidRefreshToken
+		}
+	}
+	if errors.Is(err, ErrRefreshTokenReused) {
+		refreshRotations.WithLabelValues("reused").Inc()
+		if revokeErr := revokeFamily(ctx, consumed, meta); revokeErr != nil {
+			return "", "", revokeErr
+		}
+		return "", "", err
+	}
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		refreshRotations.WithLabelValues("invalid").Inc()
+	}
 	if err != nil {
 		return "", "", err
 	}
-	newRefresh, err := CreateRefreshToken(username)
+	refreshRotations.WithLabelValues("rotated").Inc()
+	access, err := signAccessToken(consumed.Username, consumed.FamilyID, next.AccessJTI, next.AccessExpiresAt)
 	if err != nil {
 		return "", "", err
 	}
 	return access, newRefresh, nil
 }
+
+// revokeFamily handles a replayed refresh token: every refresh token of the family
+// and every access token issued from it is revoked
+func revokeFamily(ctx context.Context, reused RefreshToken, meta RefreshMeta) error {
+	slog.WarnContext(ctx, "security: refresh token reuse detected, revoking token family",
+		"user", reused.Username, "family", reused.FamilyID, "ip", meta.IP, "user_agent", meta.UserAgent)
+	family, err := refreshStore.RevokeFamily(ctx, reused.FamilyID)
+	if err != nil {
+		return err
+	}
+	return revokeAccessTokens(ctx, family)
+}
+
+// revokeAccessTokens revokes the unexpired access tokens issued with tokens
+func revokeAccessTokens(ctx context.Context, tokens []RefreshToken) error {
+	for _, t := range tokens {
+		if t.AccessJTI == "" || time.Now().After(t.AccessExpiresAt) {
+			continue
+		}
+		if err := revokeJTI(ctx, t.AccessJTI, t.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// failingRefreshStore cannot revoke tokens, like a database that went away
+type failingRefreshStore struct{ *MemoryRefreshStore }
+
+func (failingRefreshStore) RevokeUser(ctx context.Context, username string) ([]RefreshToken, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestReloadAppConfigRevokesRemovedUsers(t *testing.T) {
+	old := activeUsers.Load()
+	defer activeUsers.Store(old)
+
+	access, refresh, err := IssueTokens(context.Background(), "bob", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := []User{{Username: "alice", Password: "alice-password", Roles: []string{RoleEditor}}}
+	if err := ReloadAppConfig(context.Background(), AppConfig{Users: users}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseToken(context.Background(), access); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("access token of removed user: got %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := ValidateAndRotateRefresh(context.Background(), refresh, RefreshMeta{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh token of removed user: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestReloadAppConfigKeepsOldConfigWhenInvalid(t *testing.T) {
+	old := activeUsers.Load()
+	defer activeUsers.Store(old)
+
+	users := []User{{Username: "carol", Password: "x", Roles: []string{"no-such-role"}}}
+	if err := ReloadAppConfig(context.Background(), AppConfig{Users: users}, ""); err == nil {
+		t.Fatal("unknown role accepted")
+	}
+	if activeUsers.Load() != old {
+		t.Error("invalid config was applied")
+	}
+}
+
+func TestReloadAppConfigReportsRevocationFailure(t *testing.T) {
+	old := activeUsers.Load()
+	defer activeUsers.Store(old)
+	SetRefreshStore(failingRefreshStore{NewMemoryRefreshStore()})
+	defer SetRefreshStore(NewMemoryRefreshStore())
+
+	users := []User{{Username: "alice", Password: "alice-password", Roles: []string{RoleEditor}}}
+	err := ReloadAppConfig(context.Background(), AppConfig{Users: users}, "")
+	if !errors.Is(err, ErrTokenRevocation) {
+		t.Fatalf("got %v, want ErrTokenRevocation", err)
+	}
+	if userActive("bob") {
+		t.Error("config was not applied although only the revocation failed")
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey is one key that can verify tokens, and sign them if private is set
+type jwtKey struct {
+	kid     string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	// signingKey signs new tokens; verifyKeys holds it plus older keys kept for rotation
+	signingKey *jwtKey
+	verifyKeys = map[string]*jwtKey{}
+)
+
+// JWTKeyConfig selects the token signing keys
+type JWTKeyConfig struct {
+	// SigningKey is a PEM file with an RSA (RS256) or Ed25519 (EdDSA) private key
+	SigningKey string `yaml:"signing_key"`
+	// SigningKID is an optional key ID, defaults to the RFC 7638 thumbprint
+	SigningKID string `yaml:"signing_kid"`
+	// VerifyKeys are PEM files with public keys that are still accepted
+	VerifyKeys []string `yaml:"verify_keys"`
+	// Secret signs tokens with HS256 when no SigningKey is set
+	Secret string `yaml:"jwt_secret"`
+}
+
+// DevJWTSecret is used when neither a signing key nor a secret is configured
+const DevJWTSecret = "dev-secret-change"
+
+// LoadJWTKeys configures token signing and verification keys
+func LoadJWTKeys(cfg JWTKeyConfig) error {
+	keys := map[string]*jwtKey{}
+	var signing *jwtKey
+
+	if path := cfg.SigningKey; path != "" {
+		k, err := loadPEMKey(path)
+		if err != nil {
+			return err
+		}
+		if k.private == nil {
+			return fmt.Errorf("%s: JWT_SIGNING_KEY must be a private key", path)
+		}
+		if kid := cfg.SigningKID; kid != "" {
+			k.kid = kid
+		}
+		signing = k
+		keys[k.kid] = k
+	} else {
+		secret := cfg.Secret
+		if secret == "" {
+			secret = DevJWTSecret // for development only
+		}
+		signing = &jwtKey{kid: "hs256", method: jwt.SigningMethodHS256, private: []byte(secret), public: []byte(secret)}
+		keys[signing.kid] = signing
+	}
+
+	for _, path := range cfg.VerifyKeys {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		k, err := loadPEMKey(path)
+		if err != nil {
+			return err
+		}
+		if _, dup := keys[k.kid]; !dup {
+			keys[k.kid] = k
+		}
+	}
+
+	signingKey = signing
+	verifyKeys = keys
+	return nil
+}
+
+// JWTKeysLoaded reports whether LoadJWTKeys has configured a signing key
+func JWTKeysLoaded() bool {
+	return signingKey != nil
+}
+
+// loadPEMKey reads a PKCS#8/PKCS#1 private key, a PKIX public key or a certificate
+func loadPEMKey(path string) (*jwtKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", path)
+	}
+
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch block.Type {
+	case "PRIVATE KEY":
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			public = cert.PublicKey
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if signer, ok := private.(crypto.Signer); ok {
+		public = signer.Public()
+	}
+
+	k := &jwtKey{private: private, public: public}
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s: RSA key must be at least 2048 bits", path)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%s: only RSA and Ed25519 keys are supported", path)
+	}
+	k.kid = thumbprint(k.jwk())
+	return k, nil
+}
+
+// jwk returns the public part of an asymmetric key as a JWK
+func (k *jwtKey) jwk() JWK {
+	j := JWK{Use: "sig", Alg: k.method.Alg(), Kid: k.kid}
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		j.Kty = "RSA"
+		j.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		j.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		j.Kty = "OKP"
+		j.Crv = "Ed25519"
+		j.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return j
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint used as default kid
+func thumbprint(j JWK) string {
+	var members any
+	if j.Kty == "RSA" {
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.Kty, j.N}
+	} else {
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Crv, j.Kty, j.X}
+	}
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JWKS returns the public verification keys, current signing key first;
+// HS256 secrets are never published
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range verifyKeys {
+		if k.method == jwt.SigningMethodHS256 {
+			continue
+		}
+		set.Keys = append(set.Keys, k.jwk())
+	}
+	current := ""
+	if signingKey != nil {
+		current = signingKey.kid
+	}
+	sort.Slice(set.Keys, func(i, j int) bool {
+		if (set.Keys[i].Kid == current) != (set.Keys[j].Kid == current) {
+			return set.Keys[i].Kid == current
+		}
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+	return set
+}
+
+// signToken signs claims with the current signing key and sets the kid header
+func signToken(claims jwt.Claims) (string, error) {
+	if signingKey == nil {
+		return "", errors.New("JWT keys not loaded")
+	}
+	token := jwt.NewWithClaims(signingKey.method, claims)
+	token.Header["kid"] = signingKey.kid
+	return token.SignedString(signingKey.private)
+}
+
+// parseClaims verifies a token against the key named by its kid header
+func parseClaims(tokenString string, claims jwt.Claims) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" && signingKey != nil && signingKey.method == jwt.SigningMethodHS256 {
+			// tokens issued before kid headers were added
+			kid = signingKey.kid
+		}
+		k, ok := verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return k.public, nil
+	}, jwt.WithValidMethods([]string{
+		jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg(),
+	}))
+	return err
+}
@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writePEM stores one PEM block in a temporary file and returns its path
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), strings.ReplaceAll(strings.ToLower(blockType), " ", "_")+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rsaKeyFiles writes a new RSA key as PKCS#8 private key and PKIX public key
+func rsaKeyFiles(t *testing.T, bits int) (private, public string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "PRIVATE KEY", der), writePEM(t, "PUBLIC KEY", pub)
+}
+
+// ed25519KeyFiles writes a new Ed25519 key as PKCS#8 private key and PKIX public key
+func ed25519KeyFiles(t *testing.T) (private, public string) {
+	t.Helper()
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, "PRIVATE KEY", der), writePEM(t, "PUBLIC KEY", pubDER)
+}
+
+// loadKeys activates cfg and restores the shared test secret afterwards
+func loadKeys(t *testing.T, cfg JWTKeyConfig) {
+	t.Helper()
+	if err := LoadJWTKeys(cfg); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { LoadJWTKeys(JWTKeyConfig{Secret: "test-secret"}) })
+}
+
+// testToken signs a short-lived token with the current key and returns it with its header
+func testToken(t *testing.T) (string, map[string]any) {
+	t.Helper()
+	token, err := signToken(jwt.RegisteredClaims{Subject: "alice", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, _ := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+	var h map[string]any
+	if err := json.Unmarshal(header, &h); err != nil {
+		t.Fatal(err)
+	}
+	return token, h
+}
+
+func TestSigningKeys(t *testing.T) {
+	rsaKey, _ := rsaKeyFiles(t, 2048)
+	edKey, _ := ed25519KeyFiles(t)
+	rsaPKCS1, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPKCS1))
+
+	tests := []struct {
+		name, path, kid, alg string
+	}{
+		{"RSA PKCS#8", rsaKey, "", "RS256"},
+		{"RSA PKCS#1", pkcs1, "", "RS256"},
+		{"Ed25519", edKey, "", "EdDSA"},
+		{"configured kid", edKey, "2024-05", "EdDSA"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loadKeys(t, JWTKeyConfig{SigningKey: tt.path, SigningKID: tt.kid})
+			token, header := testToken(t)
+			if header["alg"] != tt.alg {
+				t.Errorf("alg = %v, want %s", header["alg"], tt.alg)
+			}
+			wantKID := tt.kid
+			if wantKID == "" {
+				// the default kid is the RFC 7638 thumbprint, which JWKS publishes too
+				wantKID = JWKS().Keys[0].Kid
+			}
+			if header["kid"] != wantKID {
+				t.Errorf("kid = %v, want %s", header["kid"], wantKID)
+			}
+			if err := parseClaims(token, &jwt.RegisteredClaims{}); err != nil {
+				t.Errorf("own token rejected: %v", err)
+			}
+		})
+	}
+}
+
+func TestInvalidSigningKeys(t *testing.T) {
+	_, rsaPublic := rsaKeyFiles(t, 2048)
+	smallKey, _ := rsaKeyFiles(t, 1024)
+	garbage := filepath.Join(t.TempDir(), "garbage.pem")
+	os.WriteFile(garbage, []byte("not a key"), 0o600)
+
+	for name, cfg := range map[string]JWTKeyConfig{
+		"public key as signing key": {SigningKey: rsaPublic},
+		"RSA below 2048 bits":       {SigningKey: smallKey},
+		"no PEM block":              {SigningKey: garbage},
+		"missing file":              {SigningKey: filepath.Join(t.TempDir(), "missing.pem")},
+		"bad verify key":            {Secret: "s", VerifyKeys: []string{garbage}},
+	} {
+		if err := LoadJWTKeys(cfg); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+	// a failed load keeps the previous keys
+	if _, err := signToken(jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("keys lost after failed load: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, oldPublic := ed25519KeyFiles(t)
+	newKey, _ := rsaKeyFiles(t, 2048)
+
+	loadKeys(t, JWTKeyConfig{SigningKey: oldKey})
+	oldToken, oldHeader := testToken(t)
+
+	// the old public key stays accepted while tokens it signed are still valid
+	loadKeys(t, JWTKeyConfig{SigningKey: newKey, VerifyKeys: []string{oldPublic}})
+	newToken, newHeader := testToken(t)
+	if newHeader["kid"] == oldHeader["kid"] {
+		t.Fatal("new signing key reuses the old kid")
+	}
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if err := parseClaims(token, &jwt.RegisteredClaims{}); err != nil {
+			t.Errorf("%s token rejected: %v", name, err)
+		}
+	}
+	set := JWKS()
+	if len(set.Keys) != 2 || set.Keys[0].Kid != newHeader["kid"] || set.Keys[1].Kid != oldHeader["kid"] {
+		t.Errorf("JWKS kids = %+v, want current %v first, then %v", set.Keys, newHeader["kid"], oldHeader["kid"])
+	}
+
+	// once the old key is dropped its tokens name an unknown kid
+	loadKeys(t, JWTKeyConfig{SigningKey: newKey})
+	if err := parseClaims(oldToken, &jwt.RegisteredClaims{}); err == nil || !strings.Contains(err.Error(), "unknown key id") {
+		t.Errorf("token of removed key: err = %v, want unknown key id", err)
+	}
+}
+
+func TestParseClaimsRejectsForgedTokens(t *testing.T) {
+	rsaKey, rsaPublic := rsaKeyFiles(t, 2048)
+	loadKeys(t, JWTKeyConfig{SigningKey: rsaKey})
+	_, header := testToken(t)
+	kid := header["kid"].(string)
+	claims := `{"sub":"alice","exp":` + strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10) + `}`
+
+	// alg confusion: HMAC "signed" with the published RSA public key
+	publicPEM, err := os.ReadFile(rsaPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := unsignedToken(`{"alg":"HS256","typ":"JWT","kid":"`+kid+`"}`, claims)
+	mac := hmac.New(sha256.New, publicPEM)
+	mac.Write([]byte(hs256))
+	hs256 += "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]string{
+		"alg none":        unsignedToken(`{"alg":"none","typ":"JWT","kid":"`+kid+`"}`, claims) + ".",
+		"HS256 downgrade": hs256,
+		"unknown kid":     unsignedToken(`{"alg":"RS256","typ":"JWT","kid":"unknown"}`, claims) + ".c2ln",
+		"no kid":          unsignedToken(`{"alg":"RS256","typ":"JWT"}`, claims) + ".c2ln",
+	}
+	for name, token := range tests {
+		if err := parseClaims(token, &jwt.RegisteredClaims{}); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestJWKSFormat(t *testing.T) {
+	edKey, _ := ed25519KeyFiles(t)
+	_, rsaPublic := rsaKeyFiles(t, 2048)
+	loadKeys(t, JWTKeyConfig{SigningKey: edKey, VerifyKeys: []string{rsaPublic}})
+
+	set := JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(set.Keys))
+	}
+	ed, rsaJWK := set.Keys[0], set.Keys[1]
+	if ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" || ed.N != "" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x, err := base64.RawURLEncoding.DecodeString(ed.X); err != nil || len(x) != ed25519.PublicKeySize {
+		t.Errorf("Ed25519 x = %q", ed.X)
+	}
+	if rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.E != "AQAB" || rsaJWK.X != "" {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	if n, err := base64.RawURLEncoding.DecodeString(rsaJWK.N); err != nil || len(n) != 256 {
+		t.Errorf("RSA n = %q", rsaJWK.N)
+	}
+	for _, k := range set.Keys {
+		if k.Kid != thumbprint(k) {
+			t.Errorf("kid %q is not the RFC 7638 thumbprint", k.Kid)
+		}
+	}
+
+	// HS256 secrets are never published
+	loadKeys(t, JWTKeyConfig{Secret: "s3cret"})
+	if keys := JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS with HS256 = %+v, want no keys", keys)
+	}
+}
+
+// unsignedToken joins a header and claims into the first two JWT segments
+func unsignedToken(header, claims string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+}
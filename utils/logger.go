@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestIDHeader carries the correlation ID of a request, in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client supplied request IDs before they reach the logs
+const maxRequestIDLength = 128
+
+// requestInfo is shared by all middleware of one request, so the access log
+// written by the outermost one also sees the subject set later by Secure
+type requestInfo struct {
+	id      string
+	subject string
+}
+
+const requestInfoKey contextKey = "request"
+
+// LogConfig selects the log output. Format is "json" or "text", Level one of
+// debug, info, warn, error; empty values mean text and info.
+type LogConfig struct {
+	Format string `yaml:"format"`
+	Level  string `yaml:"level"`
+}
+
+// Validate reports an unknown format or level
+func (c LogConfig) Validate() error {
+	_, err := c.handler(io.Discard)
+	return err
+}
+
+func (c LogConfig) handler(w io.Writer) (slog.Handler, error) {
+	var lvl slog.Level
+	if c.Level != "" {
+		if err := lvl.UnmarshalText([]byte(c.Level)); err != nil {
+			return nil, fmt.Errorf("log level %q: %w", c.Level, err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(c.Format) {
+	case "", "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	default:
+		return nil, fmt.Errorf("log format %q: must be json or text", c.Format)
+	}
+}
+
+// SetupLogger installs the default slog logger writing to w.
+// Standard library log output is routed through the same handler.
+func SetupLogger(w io.Writer, cfg LogConfig) error {
+	h, err := cfg.handler(w)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+	return nil
+}
+
+// contextHandler adds the request ID, subject and trace of the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		rec.AddAttrs(slog.String("request_id", info.id))
+		if info.subject != "" {
+			rec.AddAttrs(slog.String("subject", info.subject))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		rec.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// RequestID returns the correlation ID of r, or "" outside RequestLogger
+func RequestID(r *http.Request) string {
+	if info, ok := r.Context().Value(requestInfoKey).(*requestInfo); ok {
+		return info.id
+	}
+	return ""
+}
+
+// setRequestSubject records who made the request for the access log
+func setRequestSubject(ctx context.Context, subject string) {
+	if info, ok := ctx.Value(requestInfoKey).(*requestInfo); ok {
+		info.subject = subject
+	}
+}
+
+// requestIDFrom accepts a client supplied ID if it is short and printable,
+// otherwise a new random one is generated
+func requestIDFrom(r *http.Request) string {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" || len(id) > maxRequestIDLength {
+		return rand.Text()
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return rand.Text()
+		}
+	}
+	return id
+}
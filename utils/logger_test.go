@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs routes slog output of the test into a buffer of JSON lines
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	old := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(old) })
+	var buf bytes.Buffer
+	if err := SetupLogger(&buf, LogConfig{Format: "json", Level: "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// logLines decodes every JSON log line in buf
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	for line := range strings.Lines(buf.String()) {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf("log line %q: %v", line, err)
+		}
+		lines = append(lines, m)
+	}
+	return lines
+}
+
+func TestRequestIDIsPropagated(t *testing.T) {
+	buf := captureLogs(t)
+	access, _, err := IssueTokens(context.Background(), "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := RequestLogger(Secure(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "handling")
+		http.Error(w, "Character not found", http.StatusNotFound)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/characters/7", nil)
+	req.Header.Set(RequestIDHeader, "trace-123")
+	req.Header.Set("Authorization", "Bearer "+access)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(RequestIDHeader); got != "trace-123" {
+		t.Errorf("response %s = %q, want trace-123", RequestIDHeader, got)
+	}
+	if !strings.HasSuffix(rec.Body.String(), "request_id: trace-123\n") {
+		t.Errorf("error body %q lacks the request ID", rec.Body)
+	}
+	lines := logLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("got %d log lines, want the handler and access log: %s", len(lines), buf)
+	}
+	for _, line := range lines {
+		if line["request_id"] != "trace-123" || line["subject"] != "alice" {
+			t.Errorf("log line %q has request_id %v, subject %v", line["msg"], line["request_id"], line["subject"])
+		}
+	}
+	if access := lines[1]; access["msg"] != "request" || access["status"] != float64(http.StatusNotFound) || access["path"] != "/api/characters/7" {
+		t.Errorf("access log = %v", access)
+	}
+}
+
+func TestRequestIDIsGenerated(t *testing.T) {
+	buf := captureLogs(t)
+	handler := RequestLogger(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"bad"}`))
+	}))
+
+	seen := map[string]bool{}
+	for _, supplied := range []string{"", "has space", "line\nbreak", strings.Repeat("x", maxRequestIDLength+1)} {
+		req := httptest.NewRequest(http.MethodGet, "/api/characters", nil)
+		if supplied != "" {
+			req.Header.Set(RequestIDHeader, supplied)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		id := rec.Header().Get(RequestIDHeader)
+		if id == "" || id == supplied || seen[id] {
+			t.Errorf("supplied %q: response ID %q, want a new random one", supplied, id)
+		}
+		seen[id] = true
+		if rec.Body.String() != `{"error":"bad"}` {
+			t.Errorf("JSON error body changed to %q", rec.Body)
+		}
+	}
+	for _, line := range logLines(t, buf) {
+		if id, _ := line["request_id"].(string); !seen[id] {
+			t.Errorf("access log request_id %q does not match a response", id)
+		}
+	}
+}
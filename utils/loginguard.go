@@ -0,0 +1,254 @@
+package utils
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LoginPolicy configures brute-force protection of the login endpoint
+type LoginPolicy struct {
+	// FreeAttempts failures are allowed before backoff starts
+	FreeAttempts int `yaml:"free_attempts"`
+	// MaxAttempts failures for one username lock the account
+	MaxAttempts int `yaml:"max_attempts"`
+	// MaxAttemptsPerIP failures from one client IP lock out that IP
+	MaxAttemptsPerIP int `yaml:"max_attempts_per_ip"`
+	// BaseDelay is the first backoff delay, doubled after every further failure up to MaxDelay
+	BaseDelay time.Duration `yaml:"base_delay"`
+	MaxDelay  time.Duration `yaml:"max_delay"`
+	// Lockout is how long a locked username or IP stays locked
+	Lockout time.Duration `yaml:"lockout"`
+	// Window: failures older than this are forgotten
+	Window time.Duration `yaml:"window"`
+}
+
+// DefaultLoginPolicy is used for fields left empty in config.yaml
+var DefaultLoginPolicy = LoginPolicy{
+	FreeAttempts:     3,
+	MaxAttempts:      10,
+	MaxAttemptsPerIP: 50,
+	BaseDelay:        time.Second,
+	MaxDelay:         5 * time.Minute,
+	Lockout:          15 * time.Minute,
+	Window:           15 * time.Minute,
+}
+
+// WithDefaults fills zero fields from DefaultLoginPolicy
+func (p LoginPolicy) WithDefaults() LoginPolicy {
+	d := DefaultLoginPolicy
+	if p.FreeAttempts == 0 {
+		p.FreeAttempts = d.FreeAttempts
+	}
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = d.MaxAttempts
+	}
+	if p.MaxAttemptsPerIP == 0 {
+		p.MaxAttemptsPerIP = d.MaxAttemptsPerIP
+	}
+	if p.BaseDelay == 0 {
+		p.BaseDelay = d.BaseDelay
+	}
+	if p.MaxDelay == 0 {
+		p.MaxDelay = d.MaxDelay
+	}
+	if p.Lockout == 0 {
+		p.Lockout = d.Lockout
+	}
+	if p.Window == 0 {
+		p.Window = d.Window
+	}
+	return p
+}
+
+// loginFailures tracks failed logins of one username or one IP. Attempts still
+// checking their password count as pending failures, so parallel guesses cannot
+// all pass LoginAllowed before the first failure is recorded.
+type loginFailures struct {
+	count       int
+	pending     int
+	lastFailure time.Time
+	lastAttempt time.Time
+	lockedUntil time.Time
+}
+
+// loginGuard tracks failed logins per username and per client IP
+type loginGuard struct {
+	mu     sync.Mutex
+	policy LoginPolicy
+	users  map[string]*loginFailures
+	ips    map[string]*loginFailures
+}
+
+var logins = &loginGuard{
+	policy: DefaultLoginPolicy,
+	users:  map[string]*loginFailures{},
+	ips:    map[string]*loginFailures{},
+}
+
+// SetLoginPolicy changes the brute-force protection settings
+func SetLoginPolicy(p LoginPolicy) {
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	logins.policy = p.WithDefaults()
+}
+
+// LoginAllowed reports whether a login for username from ip may be attempted now;
+// if not it returns how long the caller has to wait. An allowed attempt is
+// reserved and must be settled with LoginFailed or LoginSucceeded.
+func LoginAllowed(username, ip string) (time.Duration, bool) {
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	now := time.Now()
+	// backoff slows down guessing one account; an IP is only blocked once locked,
+	// so users behind a shared NAT are not punished for someone else's typos
+	wait := max(
+		logins.wait(logins.users[username], now, logins.policy.MaxAttempts, true),
+		logins.wait(logins.ips[ip], now, logins.policy.MaxAttemptsPerIP, false))
+	if wait > 0 {
+		loginAttempts.WithLabelValues("blocked").Inc()
+		return wait, false
+	}
+	logins.reserve(logins.users, username, now)
+	logins.reserve(logins.ips, ip, now)
+	return 0, true
+}
+
+// LoginFailed settles a reserved attempt as failed and reports whether the username is now locked
+func LoginFailed(username, ip string) bool {
+	loginAttempts.WithLabelValues("failure").Inc()
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	now := time.Now()
+	userLocked := logins.fail(logins.users, username, logins.policy.MaxAttempts, now)
+	logins.fail(logins.ips, ip, logins.policy.MaxAttemptsPerIP, now)
+	return userLocked
+}
+
+// LoginSucceeded settles a reserved attempt and clears the failures of username.
+// The IP counter is kept, otherwise one valid account would let an attacker reset it.
+func LoginSucceeded(username, ip string) {
+	loginAttempts.WithLabelValues("success").Inc()
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	if f := logins.release(logins.users, username); f != nil {
+		f.count = 0
+		f.lastFailure = time.Time{}
+		if f.pending == 0 {
+			delete(logins.users, username)
+		}
+	}
+	logins.release(logins.ips, ip)
+}
+
+// UnlockUser lifts a lockout of username and reports whether it had failures recorded
+func UnlockUser(username string) bool {
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	_, ok := logins.users[username]
+	delete(logins.users, username)
+	return ok
+}
+
+// UnlockIP lifts a lockout of a client IP and reports whether it had failures recorded
+func UnlockIP(ip string) bool {
+	logins.mu.Lock()
+	defer logins.mu.Unlock()
+	_, ok := logins.ips[ip]
+	delete(logins.ips, ip)
+	return ok
+}
+
+// wait returns how long f still blocks new attempts, counting pending attempts
+// as failures
+func (g *loginGuard) wait(f *loginFailures, now time.Time, limit int, backoff bool) time.Duration {
+	if f == nil {
+		return 0
+	}
+	if now.Before(f.lockedUntil) {
+		return f.lockedUntil.Sub(now)
+	}
+	failures := f.count + f.pending
+	if failures >= limit {
+		// the attempts in flight lock the key if they fail; retry once they settle
+		return g.policy.BaseDelay
+	}
+	if !backoff {
+		return 0
+	}
+	last := f.lastFailure
+	if f.lastAttempt.After(last) {
+		last = f.lastAttempt
+	}
+	return last.Add(g.backoff(failures)).Sub(now)
+}
+
+// reserve counts an attempt for key as pending
+func (g *loginGuard) reserve(m map[string]*loginFailures, key string, now time.Time) {
+	f, ok := m[key]
+	if !ok {
+		f = &loginFailures{}
+		m[key] = f
+	}
+	f.pending++
+	f.lastAttempt = now
+}
+
+// release ends a pending attempt for key and returns its entry, if any
+func (g *loginGuard) release(m map[string]*loginFailures, key string) *loginFailures {
+	f, ok := m[key]
+	if !ok {
+		return nil
+	}
+	if f.pending > 0 {
+		f.pending--
+	}
+	return f
+}
+
+// backoff is the exponential delay after count failures
+func (g *loginGuard) backoff(count int) time.Duration {
+	n := count - g.policy.FreeAttempts
+	if n < 0 {
+		return 0
+	}
+	delay := float64(g.policy.BaseDelay) * math.Pow(2, float64(n))
+	if delay > float64(g.policy.MaxDelay) {
+		return g.policy.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// fail settles a pending attempt for key as a failure and locks the key when limit is reached
+func (g *loginGuard) fail(m map[string]*loginFailures, key string, limit int, now time.Time) bool {
+	f := g.release(m, key)
+	if f == nil {
+		f = &loginFailures{}
+		m[key] = f
+	}
+	if now.Sub(f.lastFailure) > g.policy.Window {
+		f.count = 0
+	}
+	f.count++
+	f.lastFailure = now
+	if f.count >= limit && !now.Before(f.lockedUntil) {
+		f.lockedUntil = now.Add(g.policy.Lockout)
+		f.count = 0
+		return true
+	}
+	return false
+}
+
+// prune forgets entries that no longer block anything
+func (g *loginGuard) prune() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	now := time.Now()
+	for _, m := range []map[string]*loginFailures{g.users, g.ips} {
+		for key, f := range m {
+			if f.pending == 0 && now.After(f.lockedUntil) && now.Sub(f.lastFailure) > g.policy.Window {
+				delete(m, key)
+			}
+		}
+	}
+}
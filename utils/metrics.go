@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metricsRegistry holds every metric served at /metrics
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+	httpDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+	loginAttempts = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_attempts_total",
+		Help: "Login attempts by result: success, failure or blocked (backoff/lockout).",
+	}, []string{"result"})
+	refreshRotations = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_refresh_rotations_total",
+		Help: "Refresh token rotations by result: rotated, invalid or reused.",
+	}, []string{"result"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		revocationCollector{desc: prometheus.NewDesc(
+			"auth_revoked_tokens", "Access tokens currently on the revocation list.", nil, nil)},
+	)
+}
+
+// MetricsHandler serves the metrics in Prometheus text format
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{Registry: metricsRegistry})
+}
+
+// Instrumented counts requests and measures latency of a route, and names the
+// request span after it. Put it outside Secure so rejected requests are counted
+// too; route should be the registered pattern, not the request path, to keep
+// the number of series bounded.
+func Instrumented(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + route)
+		span.SetAttributes(semconv.HTTPRoute(route))
+		lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(lrw, r)
+		status := strconv.Itoa(lrw.statusCode)
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// revocationCollector reads the revocation list size from the store at scrape time
+type revocationCollector struct {
+	desc *prometheus.Desc
+}
+
+func (c revocationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c revocationCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	n, err := revocationStore.Count(ctx)
+	if err != nil {
+		slog.Error("metrics: revoked tokens", "error", err)
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n))
+}
+
+// RegisterPoolMetrics exports connection statistics of the database pool
+func RegisterPoolMetrics(pool *pgxpool.Pool) error {
+	return metricsRegistry.Register(newPoolCollector(pool))
+}
+
+type poolCollector struct {
+	pool                                *pgxpool.Pool
+	acquired, idle, total, max          *prometheus.Desc
+	acquireCount, emptyAcquire, waitSec *prometheus.Desc
+}
+
+func newPoolCollector(pool *pgxpool.Pool) *poolCollector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc("pgxpool_"+name, help, nil, nil)
+	}
+	return &poolCollector{
+		pool:         pool,
+		acquired:     desc("acquired_connections", "Connections currently in use."),
+		idle:         desc("idle_connections", "Idle connections in the pool."),
+		total:        desc("total_connections", "Open connections, acquired, idle or being established."),
+		max:          desc("max_connections", "Maximum size of the pool."),
+		acquireCount: desc("acquire_total", "Successful connection acquisitions."),
+		emptyAcquire: desc("empty_acquire_total", "Acquisitions that had to wait because the pool was empty."),
+		waitSec:      desc("acquire_wait_seconds_total", "Total time spent waiting to acquire a connection."),
+	}
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{c.acquired, c.idle, c.total, c.max, c.acquireCount, c.emptyAcquire, c.waitSec} {
+		ch <- d
+	}
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(c.total, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(c.acquireCount, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.emptyAcquire, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(c.waitSec, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
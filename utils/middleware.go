@@ -1,50 +1,171 @@
 package utils
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"slices"
+	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+type contextKey string
+
+const (
+	subjectKey contextKey = "subject"
+	rolesKey   contextKey = "roles"
+	scopesKey  contextKey = "scopes"
 )
 
 // Secure protects endpoints using Bearer token (or fallback cookie in ExtractBearerToken)
+// or an API key, and stores the subject and roles (or key scopes) in the request context.
+// The check runs in its own "Secure" span.
 func Secure(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		spanCtx, span := tracer.Start(r.Context(), "Secure")
+		deny := func(err error, msg string, code int) {
+			failSpan(span, err)
+			span.End()
+			http.Error(w, msg, code)
+		}
+
+		if key, ok := ExtractAPIKey(r); ok {
+			span.SetAttributes(attribute.String("auth.method", "apikey"))
+			k, err := authenticateAPIKey(spanCtx, key)
+			if errors.Is(err, ErrInvalidAPIKey) {
+				deny(err, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				deny(err, "Database error", http.StatusInternalServerError)
+				return
+			}
+			span.SetAttributes(semconv.EnduserID("apikey:" + k.ID))
+			span.End()
+			setRequestSubject(r.Context(), "apikey:"+k.ID)
+			ctx := context.WithValue(r.Context(), subjectKey, "apikey:"+k.ID)
+			ctx = context.WithValue(ctx, scopesKey, k.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		span.SetAttributes(attribute.String("auth.method", "bearer"))
 		token, err := ExtractBearerToken(r)
-		if err != nil || !IsTokenValid(token) {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		if err != nil {
+			deny(err, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		claims, err := ParseToken(spanCtx, token)
+		if errors.Is(err, ErrInvalidToken) {
+			deny(err, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			// a store outage is not the client's fault; 401 would log browsers out
+			deny(err, "Database error", http.StatusInternalServerError)
+			return
+		}
+		span.SetAttributes(semconv.EnduserID(claims.Subject))
+		span.End()
+		setRequestSubject(r.Context(), claims.Subject)
+		ctx := context.WithValue(r.Context(), subjectKey, claims.Subject)
+		ctx = context.WithValue(ctx, rolesKey, claims.Roles)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
-// RequestLogger logs method, path, status, and duration
+// Subject returns the username stored by Secure, or "" for anonymous requests
+func Subject(r *http.Request) string {
+	subject, _ := r.Context().Value(subjectKey).(string)
+	return subject
+}
+
+// Roles returns the roles stored by Secure
+func Roles(r *http.Request) []string {
+	roles, _ := r.Context().Value(rolesKey).([]string)
+	return roles
+}
+
+// Permitted reports whether the request may use perm: API keys by their
+// scopes, users by the permissions of their roles
+func Permitted(r *http.Request, perm string) bool {
+	if scopes, ok := r.Context().Value(scopesKey).([]string); ok {
+		return slices.Contains(scopes, perm)
+	}
+	return HasPermission(Roles(r), perm)
+}
+
+// RequestLogger assigns every request an ID, from X-Request-ID or generated, echoes
+// it in the response and writes an access log line when the request is done.
+// Plain text error responses get the ID appended so users can quote it.
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: 200}
+		info := &requestInfo{id: requestIDFrom(r)}
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+		w.Header().Set(RequestIDHeader, info.id)
+
+		lrw := &loggingResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(lrw, r)
-		log.Printf("%s %s %d %s", r.Method, r.URL.Path, lrw.statusCode, time.Since(start))
+		if lrw.statusCode >= 400 && strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") &&
+			w.Header().Get("Content-Length") == "" {
+			fmt.Fprintf(lrw, "request_id: %s\n", info.id)
+		}
+
+		level := slog.LevelInfo
+		if lrw.statusCode >= 500 {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", lrw.statusCode,
+			"bytes", lrw.bytes,
+			"latency", time.Since(start),
+			"ip", ClientIP(r),
+			"user_agent", r.UserAgent())
 	})
 }
 
 type loggingResponseWriter struct {
 	http.ResponseWriter
-	statusCode int
+	statusCode  int
+	bytes       int64
+	wroteHeader bool
 }
 
 func (lrw *loggingResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
+	if !lrw.wroteHeader {
+		lrw.statusCode = code
+		lrw.wroteHeader = true
+	}
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+func (lrw *loggingResponseWriter) Write(b []byte) (int, error) {
+	lrw.wroteHeader = true
+	n, err := lrw.ResponseWriter.Write(b)
+	lrw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
 // Recover protects server from panics and returns 500
 func Recover(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				log.Printf("panic: %v\n%s", rec, string(debug.Stack()))
+				slog.ErrorContext(r.Context(), "panic", "error", rec, "stack", string(debug.Stack()))
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
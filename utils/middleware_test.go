@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingRevocationStore simulates an unreachable database
+type failingRevocationStore struct{ *MemoryRevocationStore }
+
+var errStoreDown = errors.New("connection refused")
+
+func (failingRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, errStoreDown
+}
+
+func TestSecureStatus(t *testing.T) {
+	access, _, err := IssueTokens(context.Background(), "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, _, err := IssueTokens(context.Background(), "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InvalidateToken(context.Background(), revoked); err != nil {
+		t.Fatal(err)
+	}
+	expired, err := signAccessToken("alice", "", generateJTI(), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		storeDown bool
+		want      int
+	}{
+		{"valid", access, false, http.StatusOK},
+		{"garbage", "not-a-jwt", false, http.StatusUnauthorized},
+		{"expired", expired, false, http.StatusUnauthorized},
+		{"revoked", revoked, false, http.StatusUnauthorized},
+		{"store down", access, true, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.storeDown {
+				SetRevocationStore(failingRevocationStore{NewMemoryRevocationStore()})
+				defer SetRevocationStore(NewMemoryRevocationStore())
+			}
+			handler := Secure(func(w http.ResponseWriter, r *http.Request) {})
+			req := httptest.NewRequest(http.MethodGet, "/api/characters", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hash algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+// argon2id parameters (OWASP recommendation: 19 MiB, 2 iterations, 1 thread)
+const (
+	argon2Memory  uint32 = 19 * 1024
+	argon2Time    uint32 = 2
+	argon2Threads uint8  = 1
+	argon2SaltLen        = 16
+	argon2KeyLen  uint32 = 32
+)
+
+// ErrUnknownHash is returned for hashes whose format is not recognised
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// dummyHash is verified when the username does not exist, so a failed login
+// takes the same time whether or not the user is configured
+var dummyHash, _ = HashPassword("dummy-password", HashArgon2id)
+
+// HashPassword hashes a password with argon2id (PHC string format) or bcrypt
+func HashPassword(password, algorithm string) (string, error) {
+	switch algorithm {
+	case HashArgon2id, "":
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	case HashBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		return string(hash), err
+	}
+	return "", fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// IsPasswordHash reports whether stored looks like a bcrypt or argon2id hash
+// rather than a plaintext password
+func IsPasswordHash(stored string) bool {
+	return isBcryptHash(stored) || strings.HasPrefix(stored, "$argon2id$")
+}
+
+func isBcryptHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// VerifyPassword checks password against a stored bcrypt/argon2id hash in constant time.
+// Plaintext values are still accepted for migration; they are compared through
+// their SHA-256 digests so the comparison does not leak the length.
+func VerifyPassword(stored, password string) (bool, error) {
+	switch {
+	case isBcryptHash(stored):
+		err := bcrypt.CompareHashAndPassword([]byte(stored), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	case strings.HasPrefix(stored, "$argon2id$"):
+		return verifyArgon2id(stored, password)
+	case strings.HasPrefix(stored, "$"):
+		return false, ErrUnknownHash
+	}
+	a := sha256.Sum256([]byte(stored))
+	b := sha256.Sum256([]byte(password))
+	return subtle.ConstantTimeCompare(a[:], b[:]) == 1, nil
+}
+
+// verifyArgon2id parses $argon2id$v=19$m=...,t=...,p=...$salt$key and recomputes the key
+func verifyArgon2id(stored, password string) (bool, error) {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 {
+		return false, ErrUnknownHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownHash)
+	}
+	var memory, iterations uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &iterations, &threads); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, fmt.Errorf("%w: invalid key", ErrUnknownHash)
+	}
+	actual := argon2.IDKey([]byte(password), salt, iterations, memory, threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
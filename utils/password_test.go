@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	argon, err := HashPassword("s3cret", HashArgon2id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := HashPassword("s3cret", HashBcrypt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argon, "$argon2id$v=19$") || !strings.HasPrefix(bcryptHash, "$2a$") {
+		t.Fatalf("unexpected hash formats %q and %q", argon, bcryptHash)
+	}
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		want     bool
+		wantErr  error
+	}{
+		{"argon2id match", argon, "s3cret", true, nil},
+		{"argon2id mismatch", argon, "S3cret", false, nil},
+		{"bcrypt match", bcryptHash, "s3cret", true, nil},
+		{"bcrypt mismatch", bcryptHash, "s3cret ", false, nil},
+		{"legacy plaintext match", "s3cret", "s3cret", true, nil},
+		{"legacy plaintext mismatch", "s3cret", "s3cre", false, nil},
+		{"legacy plaintext is not a prefix match", "s3cret", "", false, nil},
+		{"unknown hash", "$sha1$abc", "s3cret", false, ErrUnknownHash},
+		{"unknown hash is not compared as plaintext", "$sha1$abc", "$sha1$abc", false, ErrUnknownHash},
+		{"truncated argon2id", "$argon2id$v=19$m=19456,t=2,p=1$c2FsdA", "s3cret", false, ErrUnknownHash},
+		{"wrong argon2 version", strings.Replace(argon, "v=19", "v=16", 1), "s3cret", false, ErrUnknownHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := VerifyPassword(tt.stored, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if ok != tt.want {
+				t.Errorf("VerifyPassword = %v, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestHashPasswordSaltsEveryHash(t *testing.T) {
+	a, _ := HashPassword("s3cret", HashArgon2id)
+	b, _ := HashPassword("s3cret", HashArgon2id)
+	if a == b {
+		t.Error("two argon2id hashes of the same password are equal")
+	}
+	if _, err := HashPassword("s3cret", "md5"); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	old := activeUsers.Load()
+	defer activeUsers.Store(old)
+	argon, _ := HashPassword("argon-pass", HashArgon2id)
+	bcryptHash, _ := HashPassword("bcrypt-pass", HashBcrypt)
+	err := ApplyAppConfig(AppConfig{Users: []User{
+		{Username: "argon", Password: argon},
+		{Username: "bcrypt", Password: bcryptHash},
+		{Username: "legacy", Password: "legacy-pass"},
+		{Username: "disabled", Password: argon, Disabled: true},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		username, password string
+		want               bool
+	}{
+		{"argon", "argon-pass", true},
+		{"argon", "bcrypt-pass", false},
+		{"bcrypt", "bcrypt-pass", true},
+		{"bcrypt", "argon-pass", false},
+		{"legacy", "legacy-pass", true},
+		{"legacy", "legacy-pass2", false},
+		{"disabled", "argon-pass", false},
+		// unknown users are checked against the dummy hash, which must never let anyone in
+		{"nobody", "dummy-password", false},
+		{"nobody", "", false},
+	}
+	for _, tt := range tests {
+		if got := Authenticate(tt.username, tt.password); got != tt.want {
+			t.Errorf("Authenticate(%q, %q) = %v, want %v", tt.username, tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestUnknownHashInConfigIsRejected(t *testing.T) {
+	old := activeUsers.Load()
+	defer activeUsers.Store(old)
+	err := ApplyAppConfig(AppConfig{Users: []User{{Username: "carol", Password: "$md5$abc"}}}, "config.yaml")
+	if !errors.Is(err, ErrUnknownHash) {
+		t.Errorf("err = %v, want ErrUnknownHash", err)
+	}
+}
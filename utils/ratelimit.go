@@ -0,0 +1,412 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RateLimit is a token bucket: Requests tokens are refilled every Per, and at most
+// Burst (default Requests) can be spent at once. Requests 0 disables the limit.
+type RateLimit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+// RouteRateLimit is the limit of one route, optionally different per role
+type RouteRateLimit struct {
+	RateLimit `yaml:",inline"`
+	Roles     map[string]RateLimit `yaml:"roles"`
+}
+
+// RateLimitConfig is the rate_limits section of config.yaml.
+// The most specific limit wins: route+role, route, role, default.
+type RateLimitConfig struct {
+	// TrustedProxies are CIDRs or IPs whose X-Forwarded-For header is believed
+	TrustedProxies []string                  `yaml:"trusted_proxies"`
+	Default        RateLimit                 `yaml:"default"`
+	Roles          map[string]RateLimit      `yaml:"roles"`
+	Routes         map[string]RouteRateLimit `yaml:"routes"`
+}
+
+// DefaultRateLimitConfig is used when config.yaml has no rate_limits section
+var DefaultRateLimitConfig = RateLimitConfig{
+	Default: RateLimit{Requests: 300, Per: time.Minute, Burst: 60},
+	Routes: map[string]RouteRateLimit{
+		"/api/login": {RateLimit: RateLimit{Requests: 20, Per: time.Minute}},
+	},
+}
+
+// minRateLimitIdle is the shortest time a bucket is kept after its last use;
+// limits that take longer to refill keep their buckets until they are full
+const minRateLimitIdle = time.Hour
+
+// RateLimitResult is the outcome of taking one token from a bucket
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is the time until the next token, Reset the time until the bucket is full
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// RateLimitStore keeps token buckets; a shared store applies limits across instances
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+	// DeleteStale removes buckets not used since before
+	DeleteStale(ctx context.Context, before time.Time) (int64, error)
+}
+
+// rateLimitState is the active config with its parsed proxies, replaced as a whole
+type rateLimitState struct {
+	cfg     RateLimitConfig
+	proxies []*net.IPNet
+	// idle is how long an unused bucket takes to be full again, at least
+	// minRateLimitIdle; older buckets can be dropped
+	idle time.Duration
+}
+
+var (
+	activeRateLimits atomic.Pointer[rateLimitState]
+	rateLimitStore   RateLimitStore = NewMemoryRateLimitStore()
+)
+
+func init() {
+	activeRateLimits.Store(&rateLimitState{cfg: DefaultRateLimitConfig, idle: DefaultRateLimitConfig.idle()})
+}
+
+// SetRateLimitStore sets the store used for rate limit buckets
+func SetRateLimitStore(s RateLimitStore) {
+	rateLimitStore = s
+}
+
+// SetRateLimitConfig validates and activates the rate limits and trusted proxies
+func SetRateLimitConfig(cfg RateLimitConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	proxies, err := parseCIDRs(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	activeRateLimits.Store(&rateLimitState{cfg: cfg, proxies: proxies, idle: cfg.idle()})
+	return nil
+}
+
+// Validate checks the limits and trusted proxy addresses
+func (cfg RateLimitConfig) Validate() error {
+	if _, err := parseCIDRs(cfg.TrustedProxies); err != nil {
+		return err
+	}
+	check := func(name string, l RateLimit) error {
+		if l.Requests < 0 || l.Burst < 0 || (l.Requests > 0 && l.Per <= 0) {
+			return fmt.Errorf("rate_limits %s: requests and burst must be >= 0 and per > 0", name)
+		}
+		return nil
+	}
+	if err := check("default", cfg.Default); err != nil {
+		return err
+	}
+	for role, l := range cfg.Roles {
+		if err := check("role "+role, l); err != nil {
+			return err
+		}
+	}
+	for route, rl := range cfg.Routes {
+		if err := check("route "+route, rl.RateLimit); err != nil {
+			return err
+		}
+		for role, l := range rl.Roles {
+			if err := check("route "+route+" role "+role, l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("trusted_proxies: %w", err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func isTrustedProxy(trustedProxies []*net.IPNet, ip net.IP) bool {
+	for _, n := range trustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the IP address of the client that sent r. X-Forwarded-For is
+// only used when the direct peer is a trusted proxy, walking from the right past
+// every trusted hop, so clients cannot spoof their address.
+func ClientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	trustedProxies := activeRateLimits.Load().proxies
+	if len(trustedProxies) == 0 {
+		return ip
+	}
+	peer := net.ParseIP(ip)
+	if peer == nil || !isTrustedProxy(trustedProxies, peer) {
+		return ip
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		ip = hop.String()
+		if !isTrustedProxy(trustedProxies, hop) {
+			break
+		}
+	}
+	return ip
+}
+
+// limitFor picks the limit of a route for a request with the given roles;
+// with several roles the most generous one applies
+func limitFor(route string, roles []string) RateLimit {
+	pick := func(byRole map[string]RateLimit) (RateLimit, bool) {
+		var best RateLimit
+		found := false
+		for _, role := range roles {
+			if l, ok := byRole[role]; ok && (!found || l.perSecond() > best.perSecond()) {
+				best, found = l, true
+			}
+		}
+		return best, found
+	}
+	rateLimits := activeRateLimits.Load().cfg
+	if rl, ok := rateLimits.Routes[route]; ok {
+		if l, ok := pick(rl.Roles); ok {
+			return l
+		}
+		return rl.RateLimit
+	}
+	if l, ok := pick(rateLimits.Roles); ok {
+		return l
+	}
+	return rateLimits.Default
+}
+
+func (l RateLimit) perSecond() float64 {
+	if l.Requests <= 0 {
+		return math.Inf(1)
+	}
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// refill is how long an empty bucket takes to be full again
+func (l RateLimit) refill() time.Duration {
+	if l.Requests <= 0 {
+		return 0
+	}
+	return time.Duration(l.burst() / l.perSecond() * float64(time.Second))
+}
+
+// idle returns the longest refill time of all limits, at least minRateLimitIdle
+func (cfg RateLimitConfig) idle() time.Duration {
+	idle := max(minRateLimitIdle, cfg.Default.refill())
+	for _, l := range cfg.Roles {
+		idle = max(idle, l.refill())
+	}
+	for _, rl := range cfg.Routes {
+		idle = max(idle, rl.refill())
+		for _, l := range rl.Roles {
+			idle = max(idle, l.refill())
+		}
+	}
+	return idle
+}
+
+// rateLimitStaleBefore is the cutoff for dropping unused buckets
+func rateLimitStaleBefore(now time.Time) time.Time {
+	return now.Add(-activeRateLimits.Load().idle)
+}
+
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// rateLimitKey identifies who is limited: the JWT subject or API key, else the client IP
+func rateLimitKey(r *http.Request) string {
+	if subject := Subject(r); subject != "" {
+		return "sub:" + subject
+	}
+	return "ip:" + ClientIP(r)
+}
+
+// RateLimited applies the token-bucket limit of route. Put it inside Secure so
+// authenticated requests are limited per subject or API key rather than per IP.
+func RateLimited(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := limitFor(route, Roles(r))
+		if limit.Requests <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		res, err := rateLimitStore.Take(r.Context(), route+"|"+rateLimitKey(r), limit)
+		if err != nil {
+			// fail open: an unavailable store must not take the API down
+			slog.ErrorContext(r.Context(), "rate limit store", "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(int(limit.burst())))
+		h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+		h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, ceilSeconds(limit.Per), int(limit.burst())))
+		if !res.Allowed {
+			h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// takeToken refills a bucket holding tokens since elapsed and tries to take one
+func takeToken(tokens float64, elapsed time.Duration, limit RateLimit) (float64, RateLimitResult) {
+	rate, burst := limit.perSecond(), limit.burst()
+	tokens = math.Min(burst, tokens+elapsed.Seconds()*rate)
+	res := RateLimitResult{Allowed: tokens >= 1}
+	if res.Allowed {
+		tokens--
+	}
+	return tokens, bucketResult(res.Allowed, tokens, limit)
+}
+
+// bucketResult describes a bucket left with tokens
+func bucketResult(allowed bool, tokens float64, limit RateLimit) RateLimitResult {
+	rate, burst := limit.perSecond(), limit.burst()
+	res := RateLimitResult{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((burst - tokens) / rate * float64(time.Second)),
+	}
+	if tokens < 1 {
+		res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return res
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in process memory; limits apply per instance
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory rate limit store
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: limit.burst(), updated: now}
+		s.buckets[key] = b
+	}
+	var res RateLimitResult
+	b.tokens, res = takeToken(b.tokens, now.Sub(b.updated), limit)
+	b.updated = now
+	return res, nil
+}
+
+func (s *MemoryRateLimitStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for key, b := range s.buckets {
+		if b.updated.Before(before) {
+			delete(s.buckets, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PostgresRateLimitStore keeps buckets in the rate_limit_buckets table so all
+// instances share one limit per client
+type PostgresRateLimitStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRateLimitStore creates a rate limit store backed by pgxpool
+func NewPostgresRateLimitStore(pool *pgxpool.Pool) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{pool: pool}
+}
+
+// Take refills and takes a token in one upsert; the row lock of ON CONFLICT
+// serialises concurrent requests for the same key
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	var tokens float64
+	var allowed bool
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+		VALUES ($1, $2::float8 - 1, TRUE, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			allowed = LEAST($2, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3) >= 1,
+			tokens = LEAST($2, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3)
+				- CASE WHEN LEAST($2, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3) >= 1 THEN 1 ELSE 0 END,
+			updated_at = NOW()
+		RETURNING tokens, allowed`,
+		key, limit.burst(), limit.perSecond()).Scan(&tokens, &allowed)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return bucketResult(allowed, tokens, limit), nil
+}
+
+func (s *PostgresRateLimitStore) DeleteStale(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM rate_limit_buckets WHERE updated_at < $1", before)
+	return tag.RowsAffected(), err
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimitIdleCoversRefill(t *testing.T) {
+	cfg := RateLimitConfig{
+		Default: RateLimit{Requests: 300, Per: time.Minute},
+		Routes: map[string]RouteRateLimit{
+			"/api/apikeys": {Roles: map[string]RateLimit{RoleAdmin: {Requests: 1, Per: 24 * time.Hour}}},
+		},
+	}
+	if got := cfg.idle(); got != 24*time.Hour {
+		t.Errorf("idle = %v, want 24h", got)
+	}
+	if got := DefaultRateLimitConfig.idle(); got != minRateLimitIdle {
+		t.Errorf("default idle = %v, want %v", got, minRateLimitIdle)
+	}
+}
+
+func TestDrainedSlowBucketIsNotSweptEarly(t *testing.T) {
+	defer SetRateLimitConfig(DefaultRateLimitConfig)
+	limit := RateLimit{Requests: 1, Per: 24 * time.Hour}
+	if err := SetRateLimitConfig(RateLimitConfig{Default: limit}); err != nil {
+		t.Fatal(err)
+	}
+	store := NewMemoryRateLimitStore()
+	ctx := context.Background()
+	if res, _ := store.Take(ctx, "ip:192.0.2.7", limit); !res.Allowed {
+		t.Fatal("first request denied")
+	}
+	// two hours later the bucket is still far from full and must survive the sweep
+	if _, err := store.DeleteStale(ctx, rateLimitStaleBefore(time.Now().Add(2*time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := store.Take(ctx, "ip:192.0.2.7", limit); res.Allowed {
+		t.Error("bucket was swept and refilled before its refill time")
+	}
+}
+
+func TestRateLimitedTokenBucket(t *testing.T) {
+	defer SetRateLimitConfig(DefaultRateLimitConfig)
+	if err := SetRateLimitConfig(RateLimitConfig{Default: RateLimit{Requests: 2, Per: time.Minute}}); err != nil {
+		t.Fatal(err)
+	}
+	handler := RateLimited("/api/characters", func(w http.ResponseWriter, r *http.Request) {})
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/characters", nil)
+		req.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		rec := request("198.51.100.9")
+		if rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+		}
+		if rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("request %d: RateLimit-Limit = %q, want 2", i+1, rec.Header().Get("RateLimit-Limit"))
+		}
+		if want == http.StatusTooManyRequests && rec.Header().Get("Retry-After") == "" {
+			t.Error("429 without Retry-After")
+		}
+	}
+	// buckets are per client
+	if rec := request("198.51.100.10"); rec.Code != http.StatusOK {
+		t.Errorf("other client: status %d, want 200", rec.Code)
+	}
+}
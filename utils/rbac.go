@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Built-in roles assigned to users in config.yaml
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// Permissions checked by Authorize and Require
+const (
+	PermCharactersRead   = "characters:read"
+	PermCharactersWrite  = "characters:write"
+	PermCharactersDelete = "characters:delete"
+	PermCharactersPurge  = "characters:purge"
+	PermAuditRead        = "audit:read"
+	PermAPIKeysManage    = "apikeys:manage"
+	PermUsersManage      = "users:manage"
+	PermHealthRead       = "health:read"
+)
+
+// AllPermissions lists every permission known to the API
+var AllPermissions = []string{
+	PermCharactersRead,
+	PermCharactersWrite,
+	PermCharactersDelete,
+	PermCharactersPurge,
+	PermAuditRead,
+	PermAPIKeysManage,
+	PermUsersManage,
+	PermHealthRead,
+}
+
+// defaultRolePermissions: viewers read, editors also write, admins can do everything
+var defaultRolePermissions = map[string][]string{
+	RoleViewer: {PermCharactersRead},
+	RoleEditor: {PermCharactersRead, PermCharactersWrite},
+	RoleAdmin:  AllPermissions,
+}
+
+// buildRolePermissions merges role overrides from config over the defaults and validates them
+func buildRolePermissions(overrides map[string][]string) (map[string][]string, error) {
+	roles := make(map[string][]string, len(defaultRolePermissions)+len(overrides))
+	for role, perms := range defaultRolePermissions {
+		roles[role] = perms
+	}
+	for role, perms := range overrides {
+		for _, p := range perms {
+			if !slices.Contains(AllPermissions, p) {
+				return nil, fmt.Errorf("role %q: unknown permission %q", role, p)
+			}
+		}
+		roles[role] = perms
+	}
+	return roles, nil
+}
+
+// HasPermission reports whether any of the roles grants perm
+func HasPermission(roles []string, perm string) bool {
+	rolePermissions := activeUsers.Load().roles
+	for _, role := range roles {
+		if slices.Contains(rolePermissions[role], perm) {
+			return true
+		}
+	}
+	return false
+}
+
+// MethodPermissions maps HTTP methods of one route to the permission they require
+type MethodPermissions map[string]string
+
+// Authorize checks the per-method permission of a route; use inside Secure.
+// Methods missing from perms are answered with 405.
+func Authorize(perms MethodPermissions, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		perm, ok := perms[r.Method]
+		if !ok {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		Require(perm, next)(w, r)
+	}
+}
+
+// Require rejects requests whose roles or API key scopes do not grant perm; use inside Secure
+func Require(perm string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !Permitted(r, perm) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
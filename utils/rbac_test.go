@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildRolePermissions(t *testing.T) {
+	roles, err := buildRolePermissions(map[string][]string{
+		RoleEditor: {PermCharactersRead},
+		"auditor":  {PermAuditRead, PermHealthRead},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(roles[RoleViewer]); got != 1 {
+		t.Errorf("viewer has %d permissions, want the default 1", got)
+	}
+	if got := len(roles[RoleAdmin]); got != len(AllPermissions) {
+		t.Errorf("admin has %d permissions, want all %d", got, len(AllPermissions))
+	}
+	if got := roles[RoleEditor]; len(got) != 1 || got[0] != PermCharactersRead {
+		t.Errorf("overridden editor = %v, want only %s", got, PermCharactersRead)
+	}
+	if got := roles["auditor"]; len(got) != 2 {
+		t.Errorf("added auditor role = %v", got)
+	}
+
+	if _, err := buildRolePermissions(map[string][]string{"auditor": {"audit:write"}}); err == nil {
+		t.Error("unknown permission accepted")
+	}
+}
+
+func TestRequireUsesRolesFromConfig(t *testing.T) {
+	old := activeUsers.Load()
+	defer activeUsers.Store(old)
+	err := ApplyAppConfig(AppConfig{
+		Users: []User{
+			{Username: "alice", Password: "alice-password", Roles: []string{RoleEditor}},
+			{Username: "bob", Password: "bob-password", Roles: []string{"auditor"}},
+		},
+		Roles: map[string][]string{
+			RoleEditor: {PermCharactersRead},
+			"auditor":  {PermAuditRead},
+		},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, perm string
+		want       int
+	}{
+		{"alice", PermCharactersRead, http.StatusOK},
+		{"alice", PermCharactersWrite, http.StatusForbidden},
+		{"alice", PermAuditRead, http.StatusForbidden},
+		{"bob", PermAuditRead, http.StatusOK},
+		{"bob", PermCharactersRead, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		access, _, err := IssueTokens(context.Background(), tt.user, RefreshMeta{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := Secure(Require(tt.perm, func(w http.ResponseWriter, r *http.Request) {}))
+		req := httptest.NewRequest(http.MethodGet, "/api/audit", nil)
+		req.Header.Set("Authorization", "Bearer "+access)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s with %s: status %d, want %d", tt.user, tt.perm, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestAuthorizeRejectsUnmappedMethods(t *testing.T) {
+	handler := Authorize(MethodPermissions{http.MethodGet: PermCharactersRead}, func(w http.ResponseWriter, r *http.Request) {})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodDelete, "/api/characters", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status %d, want 405", rec.Code)
+	}
+}
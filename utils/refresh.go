@@ -0,0 +1,270 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown or expired refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated or revoked refresh token is presented
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the
+// opaque token is kept, so a leaked table cannot be replayed.
+// Every token rotated from the same login shares one FamilyID; rotated tokens
+// are kept until they expire so a replay can be recognised.
+type RefreshToken struct {
+	Hash     string
+	FamilyID string
+	Username string
+	// AccessJTI and AccessExpiresAt identify the access token issued together with this refresh token
+	AccessJTI       string
+	AccessExpiresAt time.Time
+	IssuedAt        time.Time
+	ExpiresAt       time.Time
+	RotatedAt       *time.Time
+	RevokedAt       *time.Time
+	UserAgent       string
+	IP              string
+}
+
+// RefreshMeta describes the client a refresh token is issued to
+type RefreshMeta struct {
+	UserAgent string
+	IP        string
+}
+
+// RefreshTokenStore persists refresh tokens
+type RefreshTokenStore interface {
+	Save(ctx context.Context, t RefreshToken) error
+	// Rotate atomically marks the unexpired token with oldHash as rotated and stores next
+	// for the same owner and family. It returns the consumed token; if that token was
+	// already rotated or revoked it is returned with ErrRefreshTokenReused.
+	Rotate(ctx context.Context, oldHash string, next RefreshToken) (RefreshToken, error)
+	// RevokeFamily revokes every token of a family and returns them
+	RevokeFamily(ctx context.Context, familyID string) ([]RefreshToken, error)
+	// RevokeUser revokes every unexpired, not yet revoked token of a user and returns them
+	RevokeUser(ctx context.Context, username string) ([]RefreshToken, error)
+	// DeleteExpired removes tokens whose expiry has passed
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+var refreshStore RefreshTokenStore = NewMemoryRefreshStore()
+
+// SetRefreshStore sets the store used for refresh tokens
+func SetRefreshStore(s RefreshTokenStore) {
+	refreshStore = s
+}
+
+// RefreshMetaFromRequest collects the issuing metadata stored with a refresh token
+func RefreshMetaFromRequest(r *http.Request) RefreshMeta {
+	return RefreshMeta{UserAgent: r.UserAgent(), IP: ClientIP(r)}
+}
+
+// hashToken returns the hex SHA-256 of an opaque token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryRefreshStore keeps refresh tokens in process memory, for development
+type MemoryRefreshStore struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+// NewMemoryRefreshStore creates an empty in-memory refresh token store
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{tokens: map[string]RefreshToken{}}
+}
+
+func (s *MemoryRefreshStore) Save(ctx context.Context, t RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[t.Hash] = t
+	return nil
+}
+
+func (s *MemoryRefreshStore) Rotate(ctx context.Context, oldHash string, next RefreshToken) (RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.tokens[oldHash]
+	if !ok || time.Now().After(old.ExpiresAt) {
+		return RefreshToken{}, ErrInvalidRefreshToken
+	}
+	if old.RotatedAt != nil || old.RevokedAt != nil {
+		return old, ErrRefreshTokenReused
+	}
+	now := time.Now()
+	old.RotatedAt = &now
+	s.tokens[oldHash] = old
+	next.Username = old.Username
+	next.FamilyID = old.FamilyID
+	s.tokens[next.Hash] = next
+	return old, nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(ctx context.Context, familyID string) ([]RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var family []RefreshToken
+	for hash, t := range s.tokens {
+		if t.FamilyID != familyID {
+			continue
+		}
+		if t.RevokedAt == nil {
+			t.RevokedAt = &now
+			s.tokens[hash] = t
+		}
+		family = append(family, t)
+	}
+	return family, nil
+}
+
+func (s *MemoryRefreshStore) RevokeUser(ctx context.Context, username string) ([]RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	var revoked []RefreshToken
+	for hash, t := range s.tokens {
+		if t.Username != username || t.RevokedAt != nil || now.After(t.ExpiresAt) {
+			continue
+		}
+		t.RevokedAt = &now
+		s.tokens[hash] = t
+		revoked = append(revoked, t)
+	}
+	return revoked, nil
+}
+
+func (s *MemoryRefreshStore) DeleteExpired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	now := time.Now()
+	for hash, t := range s.tokens {
+		if now.After(t.ExpiresAt) {
+			delete(s.tokens, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PostgresRefreshStore keeps refresh tokens in the refresh_tokens table,
+// so sessions survive restarts and are shared between instances
+type PostgresRefreshStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRefreshStore creates a refresh token store backed by pgxpool
+func NewPostgresRefreshStore(pool *pgxpool.Pool) *PostgresRefreshStore {
+	return &PostgresRefreshStore{pool: pool}
+}
+
+const refreshTokenColumns = "token_hash, family_id, username, access_jti, access_expires_at, issued_at, expires_at, rotated_at, revoked_at, user_agent, ip"
+
+func scanRefreshToken(row pgx.Row) (RefreshToken, error) {
+	var t RefreshToken
+	err := row.Scan(&t.Hash, &t.FamilyID, &t.Username, &t.AccessJTI, &t.AccessExpiresAt,
+		&t.IssuedAt, &t.ExpiresAt, &t.RotatedAt, &t.RevokedAt, &t.UserAgent, &t.IP)
+	return t, err
+}
+
+func (s *PostgresRefreshStore) Save(ctx context.Context, t RefreshToken) error {
+	return insertRefreshToken(ctx, s.pool, t)
+}
+
+// execer lets insertRefreshToken run on the pool or inside the Rotate transaction
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func insertRefreshToken(ctx context.Context, db execer, t RefreshToken) error {
+	_, err := db.Exec(ctx, `
+		INSERT INTO refresh_tokens (token_hash, family_id, username, access_jti, access_expires_at, issued_at, expires_at, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		t.Hash, t.FamilyID, t.Username, t.AccessJTI, t.AccessExpiresAt, t.IssuedAt, t.ExpiresAt, t.UserAgent, t.IP)
+	return err
+}
+
+func (s *PostgresRefreshStore) Rotate(ctx context.Context, oldHash string, next RefreshToken) (RefreshToken, error) {
+	var old RefreshToken
+	err := pgx.BeginFunc(ctx, s.pool, func(tx pgx.Tx) error {
+		// FOR UPDATE makes a concurrent rotation of the same token wait and then
+		// see it as rotated, instead of minting a second pair
+		var err error
+		old, err = scanRefreshToken(tx.QueryRow(ctx,
+			"SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash=$1 AND expires_at > NOW() FOR UPDATE", oldHash))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if old.RotatedAt != nil || old.RevokedAt != nil {
+			return ErrRefreshTokenReused
+		}
+		if _, err := tx.Exec(ctx, "UPDATE refresh_tokens SET rotated_at=NOW() WHERE token_hash=$1", oldHash); err != nil {
+			return err
+		}
+		next.Username = old.Username
+		next.FamilyID = old.FamilyID
+		return insertRefreshToken(ctx, tx, next)
+	})
+	return old, err
+}
+
+func (s *PostgresRefreshStore) RevokeFamily(ctx context.Context, familyID string) ([]RefreshToken, error) {
+	rows, err := s.pool.Query(ctx, `
+		UPDATE refresh_tokens SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE family_id=$1
+		RETURNING `+refreshTokenColumns, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return collectRefreshTokens(rows)
+}
+
+func (s *PostgresRefreshStore) RevokeUser(ctx context.Context, username string) ([]RefreshToken, error) {
+	rows, err := s.pool.Query(ctx, `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE username=$1 AND revoked_at IS NULL AND expires_at > NOW()
+		RETURNING `+refreshTokenColumns, username)
+	if err != nil {
+		return nil, err
+	}
+	return collectRefreshTokens(rows)
+}
+
+// collectRefreshTokens scans and closes rows
+func collectRefreshTokens(rows pgx.Rows) ([]RefreshToken, error) {
+	defer rows.Close()
+	var tokens []RefreshToken
+	for rows.Next() {
+		t, err := scanRefreshToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *PostgresRefreshStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM refresh_tokens WHERE expires_at <= NOW()")
+	return tag.RowsAffected(), err
+}
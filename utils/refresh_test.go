@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// useMemoryRefreshStore gives the test an empty refresh token store
+func useMemoryRefreshStore(t *testing.T) *MemoryRefreshStore {
+	t.Helper()
+	store := NewMemoryRefreshStore()
+	SetRefreshStore(store)
+	t.Cleanup(func() { SetRefreshStore(NewMemoryRefreshStore()) })
+	return store
+}
+
+func TestRefreshTokensAreStoredHashed(t *testing.T) {
+	store := useMemoryRefreshStore(t)
+	_, refresh, err := IssueTokens(context.Background(), "alice", RefreshMeta{UserAgent: "test", IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.tokens[refresh]; ok {
+		t.Fatal("raw refresh token stored")
+	}
+	stored, ok := store.tokens[hashToken(refresh)]
+	if !ok {
+		t.Fatal("refresh token hash not stored")
+	}
+	if stored.Username != "alice" || stored.UserAgent != "test" || stored.IP != "192.0.2.1" {
+		t.Errorf("stored token = %+v", stored)
+	}
+}
+
+func TestConcurrentRotationSucceedsOnce(t *testing.T) {
+	useMemoryRefreshStore(t)
+	_, refresh, err := IssueTokens(context.Background(), "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const clients = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, clients)
+	for range clients {
+		wg.Go(func() {
+			_, _, err := ValidateAndRotateRefresh(context.Background(), refresh, RefreshMeta{})
+			errs <- err
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	rotated, reused := 0, 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case errors.Is(err, ErrRefreshTokenReused):
+			reused++
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if rotated != 1 || reused != clients-1 {
+		t.Errorf("%d rotations and %d reuses, want 1 and %d", rotated, reused, clients-1)
+	}
+}
+
+func TestRotateRejectsUnknownAndExpiredTokens(t *testing.T) {
+	store := useMemoryRefreshStore(t)
+	expired := RefreshToken{Hash: hashToken("expired"), Username: "alice", FamilyID: "f", ExpiresAt: time.Now().Add(-time.Second)}
+	if err := store.Save(context.Background(), expired); err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []string{"unknown", "expired"} {
+		if _, _, err := ValidateAndRotateRefresh(context.Background(), token, RefreshMeta{}); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("%s token: err = %v, want ErrInvalidRefreshToken", token, err)
+		}
+	}
+	if n, err := store.DeleteExpired(context.Background()); err != nil || n != 1 {
+		t.Errorf("DeleteExpired = %d, %v, want 1", n, err)
+	}
+}
+
+func TestTokenIDsAreUniqueAndRandom(t *testing.T) {
+	seen := map[string]bool{}
+	for range 1000 {
+		jti, refresh := generateJTI(), generateRefreshToken()
+		if seen[jti] || seen[refresh] {
+			t.Fatalf("duplicate token ID %q or %q", jti, refresh)
+		}
+		seen[jti], seen[refresh] = true, true
+		// 26 base32 characters carry 128 random bits
+		if len(jti) != 26 || strings.Trim(jti, "ABCDEFGHIJKLMNOPQRSTUVWXYZ234567") != "" {
+			t.Fatalf("jti %q is not 26 base32 characters", jti)
+		}
+		if b, err := base64.RawURLEncoding.DecodeString(refresh); err != nil || len(b) != 32 {
+			t.Fatalf("refresh token %q does not hold 32 random bytes", refresh)
+		}
+	}
+}
+
+func TestTokensAreBoundToTheirFamily(t *testing.T) {
+	store := useMemoryRefreshStore(t)
+	ctx := context.Background()
+	access, refresh, err := IssueTokens(ctx, "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseToken(ctx, access)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := store.tokens[hashToken(refresh)]
+	if claims.FamilyID == "" || claims.FamilyID != stored.FamilyID {
+		t.Errorf("access token family %q, refresh token family %q", claims.FamilyID, stored.FamilyID)
+	}
+	if claims.ID != stored.AccessJTI {
+		t.Errorf("access jti %q, refresh token records %q", claims.ID, stored.AccessJTI)
+	}
+
+	nextAccess, nextRefresh, err := ValidateAndRotateRefresh(ctx, refresh, RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := ParseToken(ctx, nextAccess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.FamilyID != claims.FamilyID || store.tokens[hashToken(nextRefresh)].FamilyID != claims.FamilyID {
+		t.Error("rotation left the token family")
+	}
+	if next.ID == claims.ID {
+		t.Error("rotation reused the access jti")
+	}
+
+	other, _, err := IssueTokens(ctx, "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherClaims, err := ParseToken(ctx, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherClaims.FamilyID == claims.FamilyID {
+		t.Error("a new login joined an existing family")
+	}
+}
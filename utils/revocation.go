@@ -0,0 +1,251 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RevocationStore keeps the JWT IDs (jti) of revoked access tokens until they expire
+type RevocationStore interface {
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// DeleteExpired removes entries whose token has expired anyway
+	DeleteExpired(ctx context.Context) (int64, error)
+	// Count returns the number of tokens currently revoked
+	Count(ctx context.Context) (int64, error)
+}
+
+// Negative lookups are cached briefly, so a logout on another instance
+// is seen after at most revocationCacheTTL
+const (
+	revocationCacheTTL  = 5 * time.Second
+	revocationCacheSize = 10000
+)
+
+var (
+	revocationStore RevocationStore = NewMemoryRevocationStore()
+	revocationCache                 = newJTICache(revocationCacheSize)
+)
+
+// SetRevocationStore sets the store used for revoked access tokens
+func SetRevocationStore(s RevocationStore) {
+	revocationStore = s
+	revocationCache.clear()
+}
+
+// revokeJTI records a revoked jti in the store and the local cache
+func revokeJTI(ctx context.Context, jti string, expiresAt time.Time) error {
+	if err := revocationStore.Revoke(ctx, jti, expiresAt); err != nil {
+		return err
+	}
+	revocationCache.put(jti, true, expiresAt)
+	return nil
+}
+
+// isJTIRevoked consults the local cache before asking the store;
+// expiresAt is the token expiry, after which the answer no longer matters
+func isJTIRevoked(ctx context.Context, jti string, expiresAt time.Time) (bool, error) {
+	if revoked, ok := revocationCache.get(jti); ok {
+		return revoked, nil
+	}
+	revoked, err := revocationStore.IsRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+	// a revoked jti stays revoked for the rest of the token's life
+	until := time.Now().Add(revocationCacheTTL)
+	if revoked {
+		until = expiresAt
+	}
+	revocationCache.put(jti, revoked, until)
+	return revoked, nil
+}
+
+// RunSweeper periodically deletes expired revocations, refresh tokens and
+// stale login failures until ctx is done
+func RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			sweep(ctx)
+		}
+	}
+}
+
+func sweep(ctx context.Context) {
+	if n, err := revocationStore.DeleteExpired(ctx); err != nil {
+		slog.ErrorContext(ctx, "sweeper: revoked tokens", "error", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "sweeper: removed expired revoked tokens", "count", n)
+	}
+	if n, err := refreshStore.DeleteExpired(ctx); err != nil {
+		slog.ErrorContext(ctx, "sweeper: refresh tokens", "error", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "sweeper: removed expired refresh tokens", "count", n)
+	}
+	if n, err := rateLimitStore.DeleteStale(ctx, rateLimitStaleBefore(time.Now())); err != nil {
+		slog.ErrorContext(ctx, "sweeper: rate limit buckets", "error", err)
+	} else if n > 0 {
+		slog.InfoContext(ctx, "sweeper: removed idle rate limit buckets", "count", n)
+	}
+	revocationCache.prune()
+	logins.prune()
+}
+
+type jtiCacheEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+// jtiCache is a small bounded cache of revocation lookups
+type jtiCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]jtiCacheEntry
+}
+
+func newJTICache(max int) *jtiCache {
+	return &jtiCache{max: max, entries: map[string]jtiCacheEntry{}}
+}
+
+func (c *jtiCache) get(jti string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[jti]
+	if !ok || time.Now().After(e.until) {
+		return false, false
+	}
+	return e.revoked, true
+}
+
+func (c *jtiCache) put(jti string, revoked bool, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.max {
+		c.pruneLocked()
+		if len(c.entries) >= c.max {
+			c.entries = map[string]jtiCacheEntry{}
+		}
+	}
+	c.entries[jti] = jtiCacheEntry{revoked: revoked, until: until}
+}
+
+func (c *jtiCache) prune() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pruneLocked()
+}
+
+func (c *jtiCache) pruneLocked() {
+	now := time.Now()
+	for jti, e := range c.entries {
+		if now.After(e.until) {
+			delete(c.entries, jti)
+		}
+	}
+}
+
+func (c *jtiCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[string]jtiCacheEntry{}
+}
+
+// MemoryRevocationStore keeps revoked jtis in process memory, for development
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryRevocationStore creates an empty in-memory revocation store
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: map[string]time.Time{}}
+}
+
+func (s *MemoryRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if expiresAt.After(s.revoked[jti]) {
+		s.revoked[jti] = expiresAt
+	}
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	exp, ok := s.revoked[jti]
+	return ok && time.Now().Before(exp), nil
+}
+
+func (s *MemoryRevocationStore) DeleteExpired(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	now := time.Now()
+	for jti, exp := range s.revoked {
+		if !now.Before(exp) {
+			delete(s.revoked, jti)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryRevocationStore) Count(ctx context.Context) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var n int64
+	now := time.Now()
+	for _, exp := range s.revoked {
+		if now.Before(exp) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// PostgresRevocationStore keeps revoked jtis in the revoked_tokens table,
+// so a logout is seen by every instance
+type PostgresRevocationStore struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostgresRevocationStore creates a revocation store backed by pgxpool
+func NewPostgresRevocationStore(pool *pgxpool.Pool) *PostgresRevocationStore {
+	return &PostgresRevocationStore{pool: pool}
+}
+
+func (s *PostgresRevocationStore) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	_, err := s.pool.Exec(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2)
+		ON CONFLICT (jti) DO UPDATE SET expires_at = GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)`,
+		jti, expiresAt)
+	return err
+}
+
+func (s *PostgresRevocationStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := s.pool.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti=$1 AND expires_at > NOW())", jti).Scan(&revoked)
+	return revoked, err
+}
+
+func (s *PostgresRevocationStore) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM revoked_tokens WHERE expires_at <= NOW()")
+	return tag.RowsAffected(), err
+}
+
+func (s *PostgresRevocationStore) Count(ctx context.Context) (int64, error) {
+	var n int64
+	err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM revoked_tokens WHERE expires_at > NOW()").Scan(&n)
+	return n, err
+}
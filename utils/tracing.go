@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// serviceName identifies this API in traces unless OTEL_SERVICE_NAME is set
+const serviceName = "go-rest"
+
+// tracer creates the spans of this package; it follows the global provider
+var tracer = otel.Tracer("go-rest/utils")
+
+// TracingConfig selects where spans are exported
+type TracingConfig struct {
+	// Exporter is "none" (default), "stdout", "file" or "otlp"
+	Exporter string `yaml:"exporter"`
+	// File is the output path of the file exporter
+	File string `yaml:"file"`
+	// Endpoint is the OTLP/HTTP collector, host:port or a URL such as
+	// http://localhost:4318; empty uses the collector default
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends OTLP over plain HTTP, for a local collector
+	Insecure bool `yaml:"insecure"`
+}
+
+// Validate reports an unknown exporter or a file exporter without a path
+func (c TracingConfig) Validate() error {
+	switch strings.ToLower(c.Exporter) {
+	case "", "none", "stdout", "otlp":
+		return nil
+	case "file":
+		if c.File == "" {
+			return errors.New("tracing: file exporter needs a file")
+		}
+		return nil
+	default:
+		return fmt.Errorf("tracing: unknown exporter %q, use none, stdout, file or otlp", c.Exporter)
+	}
+}
+
+// SetupTracing installs the global tracer provider and the W3C traceparent
+// propagator. The returned function flushes and stops the exporter.
+func SetupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	var err error
+	switch strings.ToLower(cfg.Exporter) {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "file":
+		f, openErr := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if openErr != nil {
+			return nil, fmt.Errorf("tracing: %w", openErr)
+		}
+		closer = f
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(f))
+	case "otlp":
+		var opts []otlptracehttp.Option
+		switch {
+		case strings.Contains(cfg.Endpoint, "://"):
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, fmt.Errorf("tracing: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			err = errors.Join(err, closer.Close())
+		}
+		return err
+	}, nil
+}
+
+// Traced starts a server span for every request, continuing the trace of an
+// incoming traceparent header. Instrumented renames it after the matched route.
+func Traced(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, "http.server", otelhttp.WithSpanNameFormatter(
+		func(_ string, r *http.Request) string { return r.Method }))
+}
+
+// failSpan marks span as failed with err
+func failSpan(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.41.0"
+)
+
+func TestRequestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	access, _, err := IssueTokens(context.Background(), "alice", RefreshMeta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Traced(Instrumented("/api/characters/", Secure(func(w http.ResponseWriter, r *http.Request) {})))
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus codes.Code
+	}{
+		{"valid token", access, codes.Unset},
+		{"forged token", "not.a.token", codes.Error},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+			req := httptest.NewRequest(http.MethodGet, "/api/characters/7", nil)
+			req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			spans := map[string]sdktrace.ReadOnlySpan{}
+			for _, s := range recorder.Ended() {
+				spans[s.Name()] = s
+				if got := s.SpanContext().TraceID().String(); got != traceID {
+					t.Errorf("span %s is in trace %s, want the incoming %s", s.Name(), got, traceID)
+				}
+			}
+			server, ok := spans["GET /api/characters/"]
+			if !ok {
+				t.Fatalf("no server span named after the route, got %v", spans)
+			}
+			hasRoute := false
+			for _, a := range server.Attributes() {
+				hasRoute = hasRoute || a == semconv.HTTPRoute("/api/characters/")
+			}
+			if !hasRoute {
+				t.Errorf("server span attributes %v lack http.route", server.Attributes())
+			}
+			secure, ok := spans["Secure"]
+			if !ok {
+				t.Fatal("no Secure span")
+			}
+			if secure.Parent().SpanID() != server.SpanContext().SpanID() {
+				t.Error("Secure span is not a child of the server span")
+			}
+			if secure.Status().Code != tt.wantStatus {
+				t.Errorf("Secure span status %v, want %v", secure.Status().Code, tt.wantStatus)
+			}
+			parse, ok := spans["jwt.parse"]
+			if !ok {
+				t.Fatal("no jwt.parse span")
+			}
+			if parse.Parent().SpanID() != secure.SpanContext().SpanID() {
+				t.Error("jwt.parse span is not a child of the Secure span")
+			}
+			if parse.Status().Code != tt.wantStatus {
+				t.Errorf("jwt.parse span status %v, want %v", parse.Status().Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestMain configures signing keys and the test users shared by the utils tests
+func TestMain(m *testing.M) {
+	if err := LoadJWTKeys(JWTKeyConfig{Secret: "test-secret"}); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	users := []User{
+		{Username: "alice", Password: "alice-password", Roles: []string{RoleEditor}},
+		{Username: "bob", Password: "bob-password", Roles: []string{RoleViewer}},
+	}
+	if err := ApplyAppConfig(AppConfig{Users: users}, ""); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}